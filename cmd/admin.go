@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/config"
+	"github.com/guisithos/go-ride-names/internal/queue"
+	"github.com/guisithos/go-ride-names/internal/service"
+	"github.com/guisithos/go-ride-names/internal/storage"
+)
+
+// runCommand executes an admin subcommand against the configured store
+func runCommand(ctx context.Context, cfg *config.Config, store storage.Store, args []string) error {
+	switch args[0] {
+	case "rotate-token-keys":
+		return rotateTokenKeys(ctx, store)
+	case "dead-letters":
+		return deadLetters(ctx, queue.NewStoreQueue(store, webhookQueueName), args[1:])
+	case "webhook-subscription":
+		return webhookSubscription(ctx, newWebhookService(cfg), args[1:])
+	default:
+		return fmt.Errorf("unknown command %q (available: rotate-token-keys, dead-letters, webhook-subscription)", args[0])
+	}
+}
+
+// webhookSubscription manages the app-wide Strava push subscription:
+//
+//	webhook-subscription status
+//	webhook-subscription reconcile
+//	webhook-subscription delete
+func webhookSubscription(ctx context.Context, subscriptions *service.WebhookService, args []string) error {
+	const usage = "usage: webhook-subscription status | reconcile | delete"
+	if len(args) != 1 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "status":
+		sub, err := subscriptions.GetSubscription(ctx)
+		if err != nil {
+			return err
+		}
+		if sub == nil {
+			log.Printf("No webhook subscription")
+			return nil
+		}
+		log.Printf("Webhook subscription %d: %s", sub.ID, sub.CallbackURL)
+		return nil
+	case "reconcile":
+		_, err := subscriptions.Reconcile(ctx)
+		return err
+	case "delete":
+		return subscriptions.UnsubscribeFromWebhooks(ctx)
+	default:
+		return errors.New(usage)
+	}
+}
+
+// deadLetters manages webhook events that failed permanently:
+//
+//	dead-letters list
+//	dead-letters show <id>
+//	dead-letters replay <id>
+//	dead-letters discard <id>
+func deadLetters(ctx context.Context, q queue.DeadLetters, args []string) error {
+	const usage = "usage: dead-letters list | show <id> | replay <id> | discard <id>"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	if args[0] != "list" && len(args) != 2 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "list":
+		jobs, err := q.DeadLetters(ctx)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			fmt.Printf("%s\tattempts=%d\tfailed_at=%s\terror=%s\n",
+				job.ID, job.Attempts, job.FailedAt.Format(time.RFC3339), job.LastError)
+		}
+		log.Printf("%d dead letters", len(jobs))
+		return nil
+	case "show":
+		job, err := q.DeadLetter(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(job)
+	case "replay":
+		if _, err := q.Replay(ctx, args[1]); err != nil {
+			return err
+		}
+		log.Printf("Replayed dead letter %s", args[1])
+		return nil
+	case "discard":
+		if err := q.Discard(ctx, args[1]); err != nil {
+			return err
+		}
+		log.Printf("Discarded dead letter %s", args[1])
+		return nil
+	default:
+		return errors.New(usage)
+	}
+}
+
+// rotateTokenKeys re-encrypts every token record with the active key. Run it
+// after adding a new key to TOKEN_ENCRYPTION_KEYS and pointing
+// TOKEN_ENCRYPTION_KEY_ID at it; the old key can be removed afterwards.
+func rotateTokenKeys(ctx context.Context, store storage.Store) error {
+	encrypted, ok := store.(*storage.EncryptedStore)
+	if !ok {
+		return fmt.Errorf("token encryption is not configured")
+	}
+
+	n, err := encrypted.ReencryptTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Re-encrypted %d token records", n)
+	return nil
+}
@@ -2,16 +2,30 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/guisithos/go-ride-names/internal/auth"
 	"github.com/guisithos/go-ride-names/internal/config"
 	"github.com/guisithos/go-ride-names/internal/handlers"
+	"github.com/guisithos/go-ride-names/internal/middleware"
+	"github.com/guisithos/go-ride-names/internal/queue"
+	"github.com/guisithos/go-ride-names/internal/service"
 	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/guisithos/go-ride-names/internal/strava"
+)
+
+const (
+	// webhookQueueName is the queue holding Strava webhook events
+	webhookQueueName = "webhook"
+	// backfillQueueName is the queue holding history backfill jobs
+	backfillQueueName = "backfill"
 )
 
 func main() {
@@ -21,22 +35,35 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Configure Google Cloud Storage
-	bucketName := os.Getenv("GCS_BUCKET_NAME")
-	if bucketName == "" {
-		log.Fatal("GCS_BUCKET_NAME environment variable is required")
-	}
-
-	credentialsFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
 	ctx := context.Background()
 
 	// Initialize storage
-	store, err := storage.NewGCSStore(ctx, bucketName, credentialsFile)
+	store, err := openStore(ctx, cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 	defer store.Close()
 
+	// Encrypt tokens at rest when keys are configured
+	if cfg.Encryption.Keys != "" {
+		keyring, err := storage.ParseKeyring(cfg.Encryption.KeyID, cfg.Encryption.Keys)
+		if err != nil {
+			log.Fatalf("Failed to load token encryption keys: %v", err)
+		}
+		store = storage.NewEncryptedStore(store, keyring)
+		log.Printf("Token encryption enabled with key %q", keyring.ActiveKeyID())
+	} else {
+		log.Printf("Warning: TOKEN_ENCRYPTION_KEYS not set, tokens are stored unencrypted")
+	}
+
+	// Run an admin command instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, cfg, store, os.Args[1:]); err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		return
+	}
+
 	// Initialize templates
 	templates, err := template.ParseGlob(filepath.Join("templates", "*.html"))
 	if err != nil {
@@ -46,30 +73,181 @@ func main() {
 	// Initialize handlers
 	mux := http.NewServeMux()
 
+	// Signed session cookies shared by the OAuth and web handlers
+	sessions := auth.NewSessionManager(cfg.Session.Secret, cfg.Session.MaxAge)
+
 	// Setup OAuth handler
-	oauthHandler := auth.NewOAuthHandler(cfg, store)
+	oauthHandler := auth.NewOAuthHandler(cfg, store, sessions)
 	oauthHandler.RegisterRoutes(mux)
 
-	// Create webhook handler
-	webhookHandler := handlers.NewWebhookHandler(store, cfg)
-	webhookHandler.RegisterRoutes(mux)
+	// Create webhook handler; events are processed by background workers.
+	// Without a verify token Strava could never validate our callback, so
+	// webhooks stay off rather than running with a token nobody knows.
+	// Only events for the reconciled app-wide subscription are accepted.
+	webhooksEnabled := cfg.Webhook.VerifyToken != ""
+	subscriptions := newWebhookService(cfg)
+	webhookEvents := queue.NewStoreQueue(store, webhookQueueName)
+	webhookHandler := handlers.NewWebhookHandler(store, cfg, webhookEvents, subscriptions)
+	if webhooksEnabled {
+		webhookHandler.RegisterRoutes(mux)
+
+		webhookWorker := queue.NewWorker(webhookEvents, webhookHandler.ProcessJob, queue.WorkerOptions{
+			Concurrency: cfg.Queue.Workers,
+			MaxAttempts: cfg.Queue.MaxAttempts,
+		})
+		go webhookWorker.Run(ctx)
+	} else {
+		log.Printf("Warning: WEBHOOK_VERIFY_TOKEN not set, webhooks disabled")
+	}
+
+	// Backfills rename an athlete's older activities a few pages per job
+	backfillJobs := queue.NewStoreQueue(store, backfillQueueName)
+	backfillHandler := handlers.NewBackfillHandler(store, cfg, sessions, backfillJobs)
+	backfillHandler.RegisterRoutes(mux)
+	backfillWorker := queue.NewWorker(backfillJobs, backfillHandler.ProcessJob, queue.WorkerOptions{
+		Concurrency: cfg.Queue.Workers,
+		MaxAttempts: cfg.Queue.MaxAttempts,
+	})
+	go backfillWorker.Run(ctx)
+
+	// Admin endpoints for inspecting and replaying failed webhook events,
+	// and for managing the app-wide push subscription
+	adminHandler := handlers.NewAdminHandler(cfg.Admin.Token, webhookEvents, subscriptions)
+	adminHandler.RegisterRoutes(mux)
 
 	// Setup web handler with templates
-	webHandler := handlers.NewWebHandler(store, oauthHandler.GetConfig(), cfg, templates)
+	webHandler := handlers.NewWebHandler(store, oauthHandler.GetConfig(), cfg, templates, sessions)
 	webHandler.RegisterRoutes(mux)
 
 	// Add static file serving
 	fs := http.FileServer(http.Dir("static"))
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
 
+	health := middleware.Health(os.Getenv("K_REVISION"), os.Getenv("ENVIRONMENT"), cfg.Strava.APIURL, map[string]middleware.HealthCheck{
+		"webhook_subscription": webhookSubscriptionCheck(webhooksEnabled, subscriptions),
+		"strava_rate_limit":    rateLimitCheck(strava.DefaultRateLimiter),
+	})
+
 	// Start server
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	// Listen before reconciling: creating a subscription makes Strava call
+	// our callback to validate it
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("Failed to listen on port %s: %v", port, err)
+	}
+	if webhooksEnabled {
+		go reconcileWebhookSubscription(ctx, subscriptions)
+	}
+
 	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
+	if err := http.Serve(listener, health(mux)); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// reconcileWebhookSubscription runs the startup reconciliation, retrying with
+// backoff while Strava or our own callback is not reachable yet
+func reconcileWebhookSubscription(ctx context.Context, subscriptions *service.WebhookService) {
+	const attempts = 5
+	for attempt := 1; ; attempt++ {
+		_, err := subscriptions.Reconcile(ctx)
+		if err == nil {
+			return
+		}
+		if attempt == attempts {
+			log.Printf("Giving up on webhook subscription after %d attempts: %v", attempt, err)
+			return
+		}
+
+		delay := queue.Backoff(attempt, 5*time.Second, 2*time.Minute)
+		log.Printf("Webhook subscription reconcile failed, retrying in %v: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// webhookSubscriptionCheck reports the last reconciliation on /health
+func webhookSubscriptionCheck(enabled bool, subscriptions *service.WebhookService) middleware.HealthCheck {
+	return func() middleware.CheckStatus {
+		if !enabled {
+			return middleware.CheckStatus{Status: "disabled", Message: "WEBHOOK_VERIFY_TOKEN not set"}
+		}
+
+		status := subscriptions.LastStatus()
+		switch {
+		case status == nil:
+			return middleware.CheckStatus{Status: "pending", Message: "Subscription not reconciled yet"}
+		case status.Error != "":
+			return middleware.CheckStatus{Status: "error", Message: status.Error}
+		default:
+			return middleware.CheckStatus{
+				Status: "ok",
+				Message: fmt.Sprintf("Subscription %d %s at %s for %s",
+					status.Subscription.ID, status.Action,
+					status.CheckedAt.Format(time.RFC3339), status.Subscription.CallbackURL),
+			}
+		}
+	}
+}
+
+// rateLimitCheck reports the app's Strava API usage on /health. Being rate
+// limited is not a failure of this instance, so it never reports an error.
+func rateLimitCheck(limiter *strava.RateLimiter) middleware.HealthCheck {
+	return func() middleware.CheckStatus {
+		status := limiter.Status()
+		if status.UpdatedAt.IsZero() {
+			return middleware.CheckStatus{Status: "ok", Message: "No Strava API usage reported yet"}
+		}
+
+		message := fmt.Sprintf("15-minute %d/%d, daily %d/%d",
+			status.Overall.ShortTermUsage, status.Overall.ShortTermLimit,
+			status.Overall.DailyUsage, status.Overall.DailyLimit)
+		if status.Read.DailyLimit > 0 {
+			message += fmt.Sprintf("; reads 15-minute %d/%d, daily %d/%d",
+				status.Read.ShortTermUsage, status.Read.ShortTermLimit,
+				status.Read.DailyUsage, status.Read.DailyLimit)
+		}
+
+		if time.Now().Before(status.LimitedUntil) {
+			return middleware.CheckStatus{
+				Status:  "limited",
+				Message: fmt.Sprintf("%s; limited until %s", message, status.LimitedUntil.Format(time.RFC3339)),
+			}
+		}
+		return middleware.CheckStatus{Status: "ok", Message: message}
+	}
+}
+
+// openStore creates the storage backend selected by STORAGE_BACKEND
+func openStore(ctx context.Context, cfg *config.Config) (storage.Store, error) {
+	switch cfg.Storage.Backend {
+	case "memory":
+		log.Printf("Using in-memory storage, data will be lost on restart")
+		return storage.NewMemoryStore(), nil
+	case "file":
+		log.Printf("Using file storage at %s", cfg.Storage.Dir)
+		return storage.NewFileStore(cfg.Storage.Dir)
+	case "redis":
+		log.Printf("Using Redis storage")
+		return storage.NewRedisStore(storage.RedisOptions{URL: cfg.Redis.URL})
+	default:
+		log.Printf("Using GCS bucket %s", cfg.GCS.BucketName)
+		return storage.NewGCSStore(ctx, cfg.GCS.BucketName, cfg.GCS.CredentialsFile)
+	}
+}
+
+// newWebhookService manages the app-wide push subscription, which is
+// authenticated with the app's client credentials rather than athlete tokens
+func newWebhookService(cfg *config.Config) *service.WebhookService {
+	client := strava.NewClient("", "", cfg.StravaClientID, cfg.StravaClientSecret,
+		handlers.StravaOptions(cfg)...)
+	return service.NewWebhookService(client, cfg.Webhook.CallbackURL, cfg.Webhook.VerifyToken)
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	stateCookieName = "oauth_state"
+	stateMaxAge     = 10 * time.Minute
+
+	// CSRFHeader is the request header carrying the CSRF token for POST requests.
+	CSRFHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+)
+
+var (
+	ErrInvalidState = errors.New("invalid OAuth state")
+	ErrInvalidCSRF  = errors.New("invalid CSRF token")
+)
+
+// IssueState generates a random OAuth state value and binds it to a short-lived
+// cookie so the callback can prove it answers a login we started.
+func (m *SessionManager) IssueState(w http.ResponseWriter) (string, error) {
+	state, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %v", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    state,
+		Path:     "/callback",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(stateMaxAge.Seconds()),
+	})
+
+	return state, nil
+}
+
+// VerifyState checks the state returned by Strava against the cookie set by
+// IssueState. The cookie is always cleared, so a state can only be used once.
+func (m *SessionManager) VerifyState(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    "",
+		Path:     "/callback",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+
+	cookie, err := r.Cookie(stateCookieName)
+	if err != nil || cookie.Value == "" {
+		return ErrInvalidState
+	}
+
+	state := r.URL.Query().Get("state")
+	if subtle.ConstantTimeCompare([]byte(state), []byte(cookie.Value)) != 1 {
+		return ErrInvalidState
+	}
+
+	return nil
+}
+
+// CSRFToken derives the CSRF token for a session. It is bound to the session ID,
+// so it changes whenever the session is rotated.
+func (m *SessionManager) CSRFToken(s *Session) string {
+	return base64.RawURLEncoding.EncodeToString(m.sign("csrf|" + s.ID))
+}
+
+// VerifyCSRF checks the token sent in the X-CSRF-Token header or the csrf_token
+// form field against the request's session.
+func (m *SessionManager) VerifyCSRF(r *http.Request) error {
+	session, err := m.Get(r)
+	if err != nil {
+		return err
+	}
+
+	token := r.Header.Get(CSRFHeader)
+	if token == "" {
+		token = r.FormValue(csrfField)
+	}
+
+	if !hmac.Equal([]byte(token), []byte(m.CSRFToken(session))) {
+		return ErrInvalidCSRF
+	}
+
+	return nil
+}
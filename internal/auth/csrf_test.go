@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionManager_VerifyState(t *testing.T) {
+	m := NewSessionManager(strings.Repeat("s", 32), time.Hour)
+
+	rec := httptest.NewRecorder()
+	state, err := m.IssueState(rec)
+	require.NoError(t, err)
+	stateCookie := rec.Result().Cookies()[0]
+
+	tests := []struct {
+		name     string
+		query    string
+		cookie   *http.Cookie
+		expected error
+	}{
+		{
+			name:     "matching state",
+			query:    state,
+			cookie:   stateCookie,
+			expected: nil,
+		},
+		{
+			name:     "missing cookie",
+			query:    state,
+			cookie:   nil,
+			expected: ErrInvalidState,
+		},
+		{
+			name:     "mismatched state",
+			query:    "attacker-state",
+			cookie:   stateCookie,
+			expected: ErrInvalidState,
+		},
+		{
+			name:     "missing state",
+			query:    "",
+			cookie:   stateCookie,
+			expected: ErrInvalidState,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/callback?code=abc&state="+tt.query, nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+
+			err := m.VerifyState(httptest.NewRecorder(), req)
+			if tt.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSessionManager_VerifyCSRF(t *testing.T) {
+	m := NewSessionManager(strings.Repeat("s", 32), time.Hour)
+	cookie := issueCookie(t, m, "12345")
+
+	session, err := m.Get(requestWithCookie(cookie))
+	require.NoError(t, err)
+	token := m.CSRFToken(session)
+
+	req := httptest.NewRequest(http.MethodPost, "/subscribe", nil)
+	req.AddCookie(cookie)
+	req.Header.Set(CSRFHeader, token)
+	assert.NoError(t, m.VerifyCSRF(req))
+
+	req = httptest.NewRequest(http.MethodPost, "/subscribe", nil)
+	req.AddCookie(cookie)
+	assert.ErrorIs(t, m.VerifyCSRF(req), ErrInvalidCSRF)
+
+	// A token from another session must not be accepted
+	other, err := m.Get(requestWithCookie(issueCookie(t, m, "12345")))
+	require.NoError(t, err)
+	req = httptest.NewRequest(http.MethodPost, "/subscribe", nil)
+	req.AddCookie(cookie)
+	req.Header.Set(CSRFHeader, m.CSRFToken(other))
+	assert.ErrorIs(t, m.VerifyCSRF(req), ErrInvalidCSRF)
+}
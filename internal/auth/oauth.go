@@ -1,25 +1,32 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/guisithos/go-ride-names/internal/config"
 	"github.com/guisithos/go-ride-names/internal/storage"
 )
 
-const (
-	AuthURL  = "https://www.strava.com/oauth/authorize"
-	TokenURL = "https://www.strava.com/oauth/token"
-)
-
 type OAuth2Config struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURI  string
+	// AuthURL is where athletes are sent to approve the app, TokenURL where
+	// the code is exchanged for tokens
+	AuthURL  string
+	TokenURL string
+	// Timeout bounds the code exchange with Strava
+	Timeout time.Duration
+	// HTTPClient makes the code exchange; nil means http.DefaultClient
+	HTTPClient *http.Client
 }
 
 type Athlete struct {
@@ -34,19 +41,35 @@ type TokenResponse struct {
 	Athlete      Athlete `json:"athlete"`
 }
 
+// Tokens returns the part of the token response that is persisted per athlete
+func (t *TokenResponse) Tokens() *storage.Tokens {
+	return &storage.Tokens{
+		TokenType:    t.TokenType,
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		ExpiresAt:    t.ExpiresAt,
+	}
+}
+
 type OAuthHandler struct {
-	config *OAuth2Config
-	store  storage.Store
+	config   *OAuth2Config
+	store    storage.Store
+	sessions *SessionManager
 }
 
-func NewOAuthHandler(cfg *config.Config, store storage.Store) *OAuthHandler {
+func NewOAuthHandler(cfg *config.Config, store storage.Store, sessions *SessionManager) *OAuthHandler {
 	return &OAuthHandler{
 		config: &OAuth2Config{
 			ClientID:     cfg.StravaClientID,
 			ClientSecret: cfg.StravaClientSecret,
 			RedirectURI:  cfg.OAuth.RedirectURI,
+			AuthURL:      strings.TrimSuffix(cfg.Strava.OAuthURL, "/") + "/authorize",
+			TokenURL:     strings.TrimSuffix(cfg.Strava.OAuthURL, "/") + "/token",
+			Timeout:      cfg.Strava.Timeout,
+			HTTPClient:   cfg.Strava.HTTPClient,
 		},
-		store: store,
+		store:    store,
+		sessions: sessions,
 	}
 }
 
@@ -56,15 +79,29 @@ func (h *OAuthHandler) RegisterRoutes(mux *http.ServeMux) {
 }
 
 func (h *OAuthHandler) handleAuth(w http.ResponseWriter, r *http.Request) {
-	authURL := fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&response_type=code&scope=read,read_all,profile:read_all,activity:read_all,activity:write&approval_prompt=force",
-		AuthURL,
+	state, err := h.sessions.IssueState(w)
+	if err != nil {
+		log.Printf("Failed to create OAuth state: %v", err)
+		http.Error(w, "Failed to start authentication", http.StatusInternalServerError)
+		return
+	}
+
+	authURL := fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&response_type=code&scope=read,read_all,profile:read_all,activity:read_all,activity:write&approval_prompt=force&state=%s",
+		h.config.AuthURL,
 		h.config.ClientID,
-		url.QueryEscape(h.config.RedirectURI))
+		url.QueryEscape(h.config.RedirectURI),
+		url.QueryEscape(state))
 
 	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
 }
 
 func (h *OAuthHandler) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if err := h.sessions.VerifyState(w, r); err != nil {
+		log.Printf("Rejected OAuth callback: %v", err)
+		http.Error(w, "Invalid authentication state", http.StatusBadRequest)
+		return
+	}
+
 	code := r.URL.Query().Get("code")
 	if code == "" {
 		log.Printf("No authorization code in callback")
@@ -72,7 +109,7 @@ func (h *OAuthHandler) handleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenResp, err := exchangeCodeForToken(code, h.config)
+	tokenResp, err := exchangeCodeForToken(r.Context(), code, h.config)
 	if err != nil {
 		log.Printf("Failed to exchange code for token: %v", err)
 		http.Error(w, fmt.Sprintf("Error exchanging code: %v", err), http.StatusInternalServerError)
@@ -85,30 +122,32 @@ func (h *OAuthHandler) handleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Store the entire TokenResponse object
+	// Store the athlete's tokens
 	sessionKey := fmt.Sprintf("%d", tokenResp.Athlete.ID)
-	if err := h.store.SetTokens(sessionKey, tokenResp); err != nil {
+	if err := h.store.SaveTokens(r.Context(), sessionKey, tokenResp.Tokens()); err != nil {
 		log.Printf("Failed to store tokens: %v", err)
 		http.Error(w, "Failed to store authentication", http.StatusInternalServerError)
 		return
 	}
 
-	// Set cookie with athlete ID
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionKey,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   60 * 24 * 60 * 60, // 60 days
-	})
+	// Start a new signed session, replacing any previous one
+	if _, err := h.sessions.Issue(w, sessionKey); err != nil {
+		log.Printf("Failed to create session: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
 
 	log.Printf("Successfully authenticated athlete %d", tokenResp.Athlete.ID)
 	http.Redirect(w, r, "/dashboard", http.StatusTemporaryRedirect)
 }
 
-func exchangeCodeForToken(code string, config *OAuth2Config) (*TokenResponse, error) {
+func exchangeCodeForToken(ctx context.Context, code string, config *OAuth2Config) (*TokenResponse, error) {
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
 	data := url.Values{}
 	data.Set("client_id", config.ClientID)
 	data.Set("client_secret", config.ClientSecret)
@@ -116,12 +155,27 @@ func exchangeCodeForToken(code string, config *OAuth2Config) (*TokenResponse, er
 	data.Set("grant_type", "authorization_code")
 	data.Set("redirect_uri", config.RedirectURI)
 
-	resp, err := http.PostForm(TokenURL, data)
+	req, err := http.NewRequestWithContext(ctx, "POST", config.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request to Strava: %v", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("token exchange failed: status=%d, body=%s", resp.StatusCode, body)
+	}
+
 	var tokenResp TokenResponse
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %v", err)
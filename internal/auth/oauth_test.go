@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/config"
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuthHandler_UsesConfiguredEndpoints(t *testing.T) {
+	var tokenRequests int
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/oauth/token", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "the-code", r.Form.Get("code"))
+		tokenRequests++
+		json.NewEncoder(w).Encode(TokenResponse{
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+			Athlete:      Athlete{ID: 42},
+		})
+	}))
+	defer fake.Close()
+
+	cfg := &config.Config{StravaClientID: "id", StravaClientSecret: "secret"}
+	cfg.OAuth.RedirectURI = "http://localhost/callback"
+	cfg.Strava.OAuthURL = fake.URL + "/oauth/"
+	cfg.Strava.HTTPClient = fake.Client()
+
+	sessions := NewSessionManager(strings.Repeat("s", 32), time.Hour)
+	store := storage.NewMemoryStore()
+	h := NewOAuthHandler(cfg, store, sessions)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth", nil))
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, fake.URL+"/oauth/authorize", location.Scheme+"://"+location.Host+location.Path)
+
+	req := httptest.NewRequest(http.MethodGet, "/callback?code=the-code&state="+url.QueryEscape(location.Query().Get("state")), nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	assert.Equal(t, 1, tokenRequests)
+	tokens, err := store.LoadTokens(context.Background(), "42")
+	require.NoError(t, err)
+	assert.Equal(t, "refresh", tokens.RefreshToken)
+}
+
+func TestExchangeCodeForToken_RejectsErrorStatus(t *testing.T) {
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"Bad Request"}`))
+	}))
+	defer fake.Close()
+
+	_, err := exchangeCodeForToken(context.Background(), "code", &OAuth2Config{
+		TokenURL:   fake.URL + "/oauth/token",
+		HTTPClient: fake.Client(),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status=400")
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sessionCookieName = "session_id"
+
+var (
+	ErrNoSession      = errors.New("no session cookie")
+	ErrInvalidSession = errors.New("invalid session cookie")
+	ErrSessionExpired = errors.New("session expired")
+)
+
+// Session is the authenticated state carried by the signed session cookie.
+type Session struct {
+	ID        string
+	AthleteID string
+	ExpiresAt time.Time
+}
+
+// SessionManager issues and verifies HMAC-signed session cookies. The cookie
+// value is "<payload>.<signature>" where the payload holds a random session ID,
+// the athlete ID and the expiry, so it cannot be forged without the secret.
+type SessionManager struct {
+	secret []byte
+	maxAge time.Duration
+}
+
+func NewSessionManager(secret string, maxAge time.Duration) *SessionManager {
+	return &SessionManager{
+		secret: []byte(secret),
+		maxAge: maxAge,
+	}
+}
+
+// Issue creates a brand new session for the athlete and sets its cookie.
+// A fresh random ID is generated on every call, so logging in always rotates
+// the session.
+func (m *SessionManager) Issue(w http.ResponseWriter, athleteID string) (*Session, error) {
+	if athleteID == "" {
+		return nil, fmt.Errorf("athlete ID cannot be empty")
+	}
+
+	id, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %v", err)
+	}
+
+	session := &Session{
+		ID:        id,
+		AthleteID: athleteID,
+		ExpiresAt: time.Now().Add(m.maxAge).Truncate(time.Second),
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    m.encode(session),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  session.ExpiresAt,
+		MaxAge:   int(m.maxAge.Seconds()),
+	})
+
+	return session, nil
+}
+
+// Get returns the verified session attached to the request.
+func (m *SessionManager) Get(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, ErrNoSession
+	}
+
+	session, err := m.decode(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+
+	return session, nil
+}
+
+// Clear removes the session cookie from the browser.
+func (m *SessionManager) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+}
+
+func (m *SessionManager) encode(s *Session) string {
+	payload := strings.Join([]string{
+		s.ID,
+		s.AthleteID,
+		strconv.FormatInt(s.ExpiresAt.Unix(), 10),
+	}, "|")
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(m.sign(encoded))
+}
+
+func (m *SessionManager) decode(value string) (*Session, error) {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, m.sign(encoded)) {
+		return nil, ErrInvalidSession
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrInvalidSession
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+
+	return &Session{
+		ID:        parts[0],
+		AthleteID: parts[1],
+		ExpiresAt: time.Unix(expiresAt, 0),
+	}, nil
+}
+
+func (m *SessionManager) sign(data string) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func issueCookie(t *testing.T, m *SessionManager, athleteID string) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	_, err := m.Issue(rec, athleteID)
+	require.NoError(t, err)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return cookies[0]
+}
+
+func requestWithCookie(c *http.Cookie) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	if c != nil {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestSessionManager_RoundTrip(t *testing.T) {
+	m := NewSessionManager(strings.Repeat("s", 32), time.Hour)
+	cookie := issueCookie(t, m, "12345")
+
+	assert.NotEqual(t, "12345", cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+
+	session, err := m.Get(requestWithCookie(cookie))
+	require.NoError(t, err)
+	assert.Equal(t, "12345", session.AthleteID)
+}
+
+func TestSessionManager_RotatesOnIssue(t *testing.T) {
+	m := NewSessionManager(strings.Repeat("s", 32), time.Hour)
+	first := issueCookie(t, m, "12345")
+	second := issueCookie(t, m, "12345")
+
+	assert.NotEqual(t, first.Value, second.Value)
+}
+
+func TestSessionManager_Rejects(t *testing.T) {
+	m := NewSessionManager(strings.Repeat("s", 32), time.Hour)
+	valid := issueCookie(t, m, "12345")
+
+	tests := []struct {
+		name     string
+		cookie   *http.Cookie
+		expected error
+	}{
+		{
+			name:     "missing cookie",
+			cookie:   nil,
+			expected: ErrNoSession,
+		},
+		{
+			name:     "raw athlete ID",
+			cookie:   &http.Cookie{Name: sessionCookieName, Value: "12345"},
+			expected: ErrInvalidSession,
+		},
+		{
+			name:     "tampered signature",
+			cookie:   &http.Cookie{Name: sessionCookieName, Value: valid.Value + "x"},
+			expected: ErrInvalidSession,
+		},
+		{
+			name:     "signed with another secret",
+			cookie:   issueCookie(t, NewSessionManager(strings.Repeat("o", 32), time.Hour), "12345"),
+			expected: ErrInvalidSession,
+		},
+		{
+			name:     "expired session",
+			cookie:   issueCookie(t, NewSessionManager(strings.Repeat("s", 32), -time.Minute), "12345"),
+			expected: ErrSessionExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Get(requestWithCookie(tt.cookie))
+			assert.ErrorIs(t, err, tt.expected)
+		})
+	}
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,10 +17,46 @@ type Config struct {
 	OAuth              struct {
 		RedirectURI string
 	}
+	Strava struct {
+		// APIURL and OAuthURL point the app at Strava, or at a stand-in
+		// such as a local fake or a staging proxy
+		APIURL   string
+		OAuthURL string
+		Timeout  time.Duration
+		// HTTPClient is used for every call to Strava when set; it cannot
+		// come from the environment and is meant for tests
+		HTTPClient *http.Client
+	}
+	Storage struct {
+		Backend string
+		Dir     string
+	}
 	GCS struct {
 		BucketName      string
 		CredentialsFile string
 	}
+	Redis struct {
+		URL string
+	}
+	Encryption struct {
+		KeyID string
+		Keys  string
+	}
+	Session struct {
+		Secret string
+		MaxAge time.Duration
+	}
+	Queue struct {
+		Workers     int
+		MaxAttempts int
+	}
+	Admin struct {
+		Token string
+	}
+	Webhook struct {
+		CallbackURL string
+		VerifyToken string
+	}
 }
 
 // LoadConfig loads configuration from environment variables
@@ -32,6 +71,17 @@ func LoadConfig() (*Config, error) {
 	config.StravaClientSecret = os.Getenv("STRAVA_CLIENT_SECRET")
 	config.BaseURL = getEnvOrDefault("BASE_URL", "http://localhost:8080")
 
+	// Strava endpoints default to production
+	config.Strava.APIURL = getEnvOrDefault("STRAVA_API_URL", "https://www.strava.com/api/v3")
+	config.Strava.OAuthURL = getEnvOrDefault("STRAVA_OAUTH_URL", "https://www.strava.com/oauth")
+
+	// Each call to the Strava API is bounded by STRAVA_TIMEOUT
+	stravaTimeout, err := getDurationOrDefault("STRAVA_TIMEOUT", 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	config.Strava.Timeout = stravaTimeout
+
 	// If OAUTH_REDIRECT_URI is not set, construct it from BASE_URL
 	redirectURI := os.Getenv("OAUTH_REDIRECT_URI")
 	if redirectURI == "" {
@@ -39,10 +89,44 @@ func LoadConfig() (*Config, error) {
 	}
 	config.OAuth.RedirectURI = redirectURI
 
+	// Load storage configuration
+	config.Storage.Backend = getEnvOrDefault("STORAGE_BACKEND", "gcs")
+	config.Storage.Dir = getEnvOrDefault("STORAGE_DIR", "data")
+
 	// Load GCS configuration
 	config.GCS.BucketName = getEnvOrDefault("GCS_BUCKET_NAME", "")
 	config.GCS.CredentialsFile = getEnvOrDefault("GOOGLE_APPLICATION_CREDENTIALS", "")
 
+	// Load Redis configuration
+	config.Redis.URL = os.Getenv("REDIS_URL")
+
+	// Load token encryption configuration
+	config.Encryption.Keys = os.Getenv("TOKEN_ENCRYPTION_KEYS")
+	config.Encryption.KeyID = os.Getenv("TOKEN_ENCRYPTION_KEY_ID")
+
+	// Load session configuration
+	config.Session.Secret = os.Getenv("SESSION_SECRET")
+	maxAge, err := getDurationOrDefault("SESSION_MAX_AGE", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	config.Session.MaxAge = maxAge
+
+	// Load webhook queue configuration
+	if config.Queue.Workers, err = getIntOrDefault("QUEUE_WORKERS", 2); err != nil {
+		return nil, err
+	}
+	if config.Queue.MaxAttempts, err = getIntOrDefault("QUEUE_MAX_ATTEMPTS", 8); err != nil {
+		return nil, err
+	}
+
+	// Load webhook configuration
+	config.Webhook.CallbackURL = getEnvOrDefault("WEBHOOK_CALLBACK_URL", config.BaseURL+"/webhook")
+	config.Webhook.VerifyToken = os.Getenv("WEBHOOK_VERIFY_TOKEN")
+
+	// Load admin configuration; admin endpoints are disabled without a token
+	config.Admin.Token = os.Getenv("ADMIN_TOKEN")
+
 	// Validate required fields
 	if config.StravaClientID == "" {
 		return nil, fmt.Errorf("STRAVA_CLIENT_ID is required")
@@ -50,8 +134,24 @@ func LoadConfig() (*Config, error) {
 	if config.StravaClientSecret == "" {
 		return nil, fmt.Errorf("STRAVA_CLIENT_SECRET is required")
 	}
-	if config.GCS.BucketName == "" {
-		return nil, fmt.Errorf("GCS_BUCKET_NAME is required")
+	if len(config.Session.Secret) < 32 {
+		return nil, fmt.Errorf("SESSION_SECRET is required and must be at least 32 characters")
+	}
+	if config.Encryption.Keys != "" && config.Encryption.KeyID == "" {
+		return nil, fmt.Errorf("TOKEN_ENCRYPTION_KEY_ID is required when TOKEN_ENCRYPTION_KEYS is set")
+	}
+	switch config.Storage.Backend {
+	case "gcs":
+		if config.GCS.BucketName == "" {
+			return nil, fmt.Errorf("GCS_BUCKET_NAME is required")
+		}
+	case "redis":
+		if config.Redis.URL == "" {
+			return nil, fmt.Errorf("REDIS_URL is required")
+		}
+	case "file", "memory":
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (expected gcs, redis, file or memory)", config.Storage.Backend)
 	}
 
 	return config, nil
@@ -63,3 +163,27 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getDurationOrDefault(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return d, nil
+}
+
+func getIntOrDefault(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return n, nil
+}
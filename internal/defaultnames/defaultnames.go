@@ -0,0 +1,162 @@
+// Package defaultnames recognises the titles Strava gives activities that the
+// athlete did not name, such as "Morning Run" or "Corrida matinal". The
+// titles of each locale are built from a data file in locales/ that lists the
+// locale's sport names and how they combine with the time of day.
+//
+// Every sport name combines with every time of day, so the files list only
+// the exact words Strava uses. A guessed variant would turn titles athletes
+// type themselves, like "Treino noturno", into defaults that get renamed. A
+// sport whose localized title is not known is left out of the locale.
+package defaultnames
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// Default recognises the titles of every locale shipped with the package
+var Default = mustLoad(locales, "locales")
+
+// Match describes a recognised default title
+type Match struct {
+	Locale string
+	// SportType is the Strava sport_type the title is for, empty for the
+	// generic "Activity" title
+	SportType string
+	// TimeOfDay is one of morning, lunch, afternoon, evening or night
+	TimeOfDay string
+}
+
+// localeFile is the format of the files in locales/
+type localeFile struct {
+	Locale string `json:"locale"`
+	// Formats combine a sport name and a time of day into a title, e.g.
+	// "{time} {sport}". Each has its own time words, since the words can
+	// differ between formats, as in German "Morgenlauf" and "Lauf am Morgen".
+	Formats []struct {
+		Pattern string              `json:"pattern"`
+		Times   map[string][]string `json:"times"`
+	} `json:"formats"`
+	// Sports maps a Strava sport_type to its names in the locale
+	Sports map[string][]string `json:"sports"`
+}
+
+// Detector recognises default titles
+type Detector struct {
+	titles  map[string]Match
+	locales []string
+}
+
+// Load builds a detector from the *.json locale files in dir
+func Load(fsys fs.FS, dir string) (*Detector, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no locale files in %s", dir)
+	}
+	sort.Strings(files)
+
+	d := &Detector{titles: make(map[string]Match)}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var locale localeFile
+		if err := json.Unmarshal(data, &locale); err != nil {
+			return nil, fmt.Errorf("invalid locale file %s: %v", file, err)
+		}
+		if err := d.add(&locale); err != nil {
+			return nil, fmt.Errorf("invalid locale file %s: %v", file, err)
+		}
+	}
+	return d, nil
+}
+
+func mustLoad(fsys fs.FS, dir string) *Detector {
+	d, err := Load(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// add indexes every title of the locale. A title that can be read several
+// ways, within a locale or across locales, keeps the first match.
+func (d *Detector) add(locale *localeFile) error {
+	if locale.Locale == "" {
+		return fmt.Errorf("missing locale")
+	}
+	if len(locale.Formats) == 0 || len(locale.Sports) == 0 {
+		return fmt.Errorf("locale %s needs formats and sports", locale.Locale)
+	}
+
+	for _, format := range locale.Formats {
+		if !strings.Contains(format.Pattern, "{sport}") || !strings.Contains(format.Pattern, "{time}") {
+			return fmt.Errorf("pattern %q must contain {sport} and {time}", format.Pattern)
+		}
+		for _, timeOfDay := range sortedKeys(format.Times) {
+			for _, timeWord := range format.Times[timeOfDay] {
+				for _, sportType := range sortedKeys(locale.Sports) {
+					for _, sportName := range locale.Sports[sportType] {
+						title := strings.NewReplacer("{time}", timeWord, "{sport}", sportName).Replace(format.Pattern)
+						key := normalize(title)
+						if _, exists := d.titles[key]; !exists {
+							d.titles[key] = Match{Locale: locale.Locale, SportType: sportType, TimeOfDay: timeOfDay}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	d.locales = append(d.locales, locale.Locale)
+	return nil
+}
+
+// Match reports whether name is a default title. Case, surrounding and
+// repeated spaces and the style of apostrophe do not matter.
+func (d *Detector) Match(name string) (Match, bool) {
+	match, ok := d.titles[normalize(name)]
+	return match, ok
+}
+
+// Locales returns the locales the detector knows, in file name order
+func (d *Detector) Locales() []string {
+	return append([]string(nil), d.locales...)
+}
+
+// Detect matches name against the default detector
+func Detect(name string) (Match, bool) {
+	return Default.Match(name)
+}
+
+// IsDefault reports whether name is a default title in any shipped locale
+func IsDefault(name string) bool {
+	_, ok := Default.Match(name)
+	return ok
+}
+
+func normalize(name string) string {
+	name = strings.ReplaceAll(name, "’", "'")
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
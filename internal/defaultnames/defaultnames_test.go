@@ -0,0 +1,179 @@
+package defaultnames
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefault_Locales(t *testing.T) {
+	assert.Equal(t, []string{"de", "en", "es", "fr", "it", "pt-BR"}, Default.Locales())
+}
+
+func TestDefault_Match(t *testing.T) {
+	tests := map[string][]struct {
+		title     string
+		sportType string
+		timeOfDay string
+	}{
+		"en": {
+			{"Morning Run", "Run", "morning"},
+			{"Lunch Ride", "Ride", "lunch"},
+			{"Morning Hike", "Hike", "morning"},
+			{"Evening Virtual Ride", "VirtualRide", "evening"},
+			{"Afternoon Weight Training", "WeightTraining", "afternoon"},
+			{"Night Walk", "Walk", "night"},
+			{"Morning Activity", "", "morning"},
+		},
+		"pt-BR": {
+			{"Corrida matinal", "Run", "morning"},
+			{"Pedalada vespertina", "Ride", "afternoon"},
+			{"Caminhada noturna", "Walk", "night"},
+			{"Pedalada ao entardecer", "Ride", "evening"},
+			{"Natação na hora do almoço", "Swim", "lunch"},
+			{"Musculação matinal", "WeightTraining", "morning"},
+			{"Trilha matinal", "Hike", "morning"},
+		},
+		"es": {
+			{"Carrera matutina", "Run", "morning"},
+			{"Vuelta en bicicleta por la tarde", "Ride", "afternoon"},
+			{"Natación nocturna", "Swim", "night"},
+			{"Caminata a la hora del almuerzo", "Walk", "lunch"},
+		},
+		"fr": {
+			{"Course à pied le matin", "Run", "morning"},
+			{"Sortie vélo dans l'après-midi", "Ride", "afternoon"},
+			{"Randonnée en soirée", "Hike", "evening"},
+			{"Natation à l'heure du déjeuner", "Swim", "lunch"},
+		},
+		"de": {
+			{"Morgenlauf", "Run", "morning"},
+			{"Abendradfahrt", "Ride", "evening"},
+			{"Lauf am Nachmittag", "Run", "afternoon"},
+			{"Wanderung am Morgen", "Hike", "morning"},
+			{"Schwimmen in der Nacht", "Swim", "night"},
+		},
+		"it": {
+			{"Corsa mattutina", "Run", "morning"},
+			{"Giro in bici pomeridiano", "Ride", "afternoon"},
+			{"Camminata serale", "Walk", "evening"},
+			{"Nuotata all'ora di pranzo", "Swim", "lunch"},
+		},
+	}
+
+	for locale, titles := range tests {
+		t.Run(locale, func(t *testing.T) {
+			for _, tt := range titles {
+				match, ok := Default.Match(tt.title)
+				if assert.True(t, ok, tt.title) {
+					assert.Equal(t, Match{Locale: locale, SportType: tt.sportType, TimeOfDay: tt.timeOfDay}, match, tt.title)
+				}
+			}
+		})
+	}
+}
+
+func TestDefault_NoMatch(t *testing.T) {
+	for _, title := range []string{
+		"",
+		"Hill repeats",
+		"Morning Run with Ana",
+		"Corrida com os amigos",
+		"Run",
+		"Morning",
+		"🏃‍♂️ 'Minha corrida é como meu código'",
+	} {
+		assert.False(t, IsDefault(title), title)
+	}
+}
+
+// Titles athletes write themselves that look like, but are not, the ones
+// Strava generates
+func TestDefault_NoMatchUserVariants(t *testing.T) {
+	tests := map[string][]string{
+		"en": {"Morning Climb", "Afternoon Ski", "Evening Skate", "Night Football", "Morning Jog", "Sunday Run"},
+		"pt-BR": {
+			"Corrida da tarde", "Corrida à tarde", "Treino noturno", "Treino matinal", "Exercício matinal",
+			"Pedalada ao fim da tarde", "Corrida da manhã", "Escada matinal", "Patins à noite", "Pedal matinal",
+		},
+		"es": {"Carrera de tarde", "Entrenamiento nocturno", "Bicicleta por la mañana", "Carrera al mediodía", "Paseo nocturno"},
+		"fr": {"Course le soir", "Vélo le matin", "Course à pied le soir", "Sortie vélo du matin", "Entraînement du soir"},
+		"de": {"Training am Abend", "Fahrt am Morgen", "Lauf bei Nacht", "Morgentraining", "Skifahren am Morgen"},
+		"it": {"Allenamento serale", "Pedalata mattutina", "Corsa della sera", "Nuoto serale", "Giro in bicicletta a pranzo"},
+	}
+
+	for locale, titles := range tests {
+		t.Run(locale, func(t *testing.T) {
+			for _, title := range titles {
+				assert.False(t, IsDefault(title), title)
+			}
+		})
+	}
+}
+
+func TestDefault_Normalizes(t *testing.T) {
+	assert.True(t, IsDefault("  morning   RUN "))
+	assert.True(t, IsDefault("CORRIDA MATINAL"))
+	assert.True(t, IsDefault("Course à pied à l’heure du déjeuner"))
+}
+
+// A locale may only name sports en names, and must name all times of day
+func TestLocaleFiles_Complete(t *testing.T) {
+	files, err := locales.ReadDir("locales")
+	require.NoError(t, err)
+
+	var en localeFile
+	data, err := locales.ReadFile("locales/en.json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &en))
+
+	for _, file := range files {
+		t.Run(file.Name(), func(t *testing.T) {
+			data, err := locales.ReadFile("locales/" + file.Name())
+			require.NoError(t, err)
+			var locale localeFile
+			require.NoError(t, json.Unmarshal(data, &locale))
+
+			assert.Subset(t, sortedKeys(en.Sports), sortedKeys(locale.Sports))
+			for sportType, names := range locale.Sports {
+				assert.NotEmpty(t, names, sportType)
+			}
+			for _, format := range locale.Formats {
+				assert.ElementsMatch(t, []string{"morning", "lunch", "afternoon", "evening", "night"}, sortedKeys(format.Times), format.Pattern)
+			}
+		})
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"bad json":        `{`,
+		"no locale":       `{"formats": [{"pattern": "{time} {sport}"}], "sports": {"Run": ["Run"]}}`,
+		"no sports":       `{"locale": "xx", "formats": [{"pattern": "{time} {sport}"}]}`,
+		"pattern no time": `{"locale": "xx", "formats": [{"pattern": "{sport}"}], "sports": {"Run": ["Run"]}}`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(fstest.MapFS{"locales/xx.json": {Data: []byte(content)}}, "locales")
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := Load(fstest.MapFS{}, "locales")
+	assert.Error(t, err)
+}
+
+func TestLoad_FirstLocaleWins(t *testing.T) {
+	d, err := Load(fstest.MapFS{
+		"locales/a.json": {Data: []byte(`{"locale": "a", "formats": [{"pattern": "{time} {sport}", "times": {"morning": ["Morning"]}}], "sports": {"Yoga": ["Yoga"]}}`)},
+		"locales/b.json": {Data: []byte(`{"locale": "b", "formats": [{"pattern": "{time} {sport}", "times": {"morning": ["Morning"]}}], "sports": {"Workout": ["Yoga"]}}`)},
+	}, "locales")
+	require.NoError(t, err)
+
+	match, ok := d.Match("Morning Yoga")
+	require.True(t, ok)
+	assert.Equal(t, Match{Locale: "a", SportType: "Yoga", TimeOfDay: "morning"}, match)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/guisithos/go-ride-names/internal/queue"
+	"github.com/guisithos/go-ride-names/internal/service"
+)
+
+const deadLettersPath = "/admin/dead-letters/"
+
+// AdminHandler exposes operational endpoints guarded by a static bearer
+// token. Without a token the endpoints are not registered.
+type AdminHandler struct {
+	token         string
+	deadLetters   queue.DeadLetters
+	subscriptions *service.WebhookService
+}
+
+func NewAdminHandler(token string, deadLetters queue.DeadLetters, subscriptions *service.WebhookService) *AdminHandler {
+	return &AdminHandler{
+		token:         token,
+		deadLetters:   deadLetters,
+		subscriptions: subscriptions,
+	}
+}
+
+func (h *AdminHandler) RegisterRoutes(mux *http.ServeMux) {
+	if h.token == "" {
+		log.Printf("ADMIN_TOKEN not set, admin endpoints disabled")
+		return
+	}
+	mux.HandleFunc("/admin/dead-letters", h.requireToken(h.handleListDeadLetters))
+	mux.HandleFunc(deadLettersPath, h.requireToken(h.handleDeadLetter))
+	mux.HandleFunc("/admin/webhook-subscription", h.requireToken(h.handleWebhookSubscription))
+}
+
+func (h *AdminHandler) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleListDeadLetters serves GET /admin/dead-letters
+func (h *AdminHandler) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobs, err := h.deadLetters.DeadLetters(r.Context())
+	if err != nil {
+		log.Printf("Error listing dead letters: %v", err)
+		http.Error(w, "Failed to list dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, jobs)
+}
+
+// handleDeadLetter serves
+//
+//	GET    /admin/dead-letters/<id>         inspect a failed job
+//	POST   /admin/dead-letters/<id>/replay  put it back in the queue
+//	DELETE /admin/dead-letters/<id>         discard it
+func (h *AdminHandler) handleDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, deadLettersPath), "/")
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		job, err := h.deadLetters.DeadLetter(r.Context(), id)
+		if err != nil {
+			h.deadLetterError(w, id, err)
+			return
+		}
+		writeJSON(w, job)
+
+	case action == "replay" && r.Method == http.MethodPost:
+		job, err := h.deadLetters.Replay(r.Context(), id)
+		if err != nil {
+			h.deadLetterError(w, id, err)
+			return
+		}
+		log.Printf("Replayed dead letter %s", id)
+		writeJSON(w, job)
+
+	case action == "" && r.Method == http.MethodDelete:
+		if err := h.deadLetters.Discard(r.Context(), id); err != nil {
+			h.deadLetterError(w, id, err)
+			return
+		}
+		log.Printf("Discarded dead letter %s", id)
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "" || action == "replay":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleWebhookSubscription manages the app-wide Strava push subscription:
+//
+//	GET    /admin/webhook-subscription  show the current subscription
+//	POST   /admin/webhook-subscription  reconcile it with our callback URL
+//	DELETE /admin/webhook-subscription  delete it, stopping auto-rename for everyone
+func (h *AdminHandler) handleWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		sub, err := h.subscriptions.GetSubscription(r.Context())
+		if err != nil {
+			log.Printf("Error getting webhook subscription: %v", err)
+			http.Error(w, "Failed to get subscription", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"active": sub != nil, "subscription": sub})
+
+	case http.MethodPost:
+		status, err := h.subscriptions.Reconcile(r.Context())
+		if err != nil {
+			log.Printf("Error reconciling webhook subscription: %v", err)
+			http.Error(w, "Failed to reconcile subscription", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, status)
+
+	case http.MethodDelete:
+		if err := h.subscriptions.UnsubscribeFromWebhooks(r.Context()); err != nil {
+			log.Printf("Error deleting webhook subscription: %v", err)
+			http.Error(w, "Failed to delete subscription", http.StatusBadGateway)
+			return
+		}
+		log.Printf("Deleted webhook subscription")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AdminHandler) deadLetterError(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, queue.ErrJobNotFound) {
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Error handling dead letter %s: %v", id, err)
+	http.Error(w, "Failed to handle dead letter", http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
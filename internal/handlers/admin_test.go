@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/queue"
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAdminTest(t *testing.T) (*http.ServeMux, *queue.StoreQueue, *queue.Job) {
+	ctx := context.Background()
+	t.Helper()
+	q := queue.NewStoreQueue(storage.NewMemoryStore(), "webhook")
+	job, err := q.Enqueue(ctx, WebhookEvent{ObjectType: "activity", ObjectID: 1, AspectType: "create", OwnerID: 7})
+	require.NoError(t, err)
+	job.Attempts = 8
+	require.NoError(t, q.Bury(ctx, job, errors.New("rate limited")))
+
+	mux := http.NewServeMux()
+	NewAdminHandler("admin-secret", q, nil).RegisterRoutes(mux)
+	return mux, q, job
+}
+
+func adminRequest(mux *http.ServeMux, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminHandler_RequiresToken(t *testing.T) {
+	mux, _, _ := newAdminTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/dead-letters", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAdminHandler_ListAndInspect(t *testing.T) {
+	mux, _, job := newAdminTest(t)
+
+	rec := adminRequest(mux, http.MethodGet, "/admin/dead-letters")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var jobs []queue.Job
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&jobs))
+	require.Len(t, jobs, 1)
+	assert.Equal(t, job.ID, jobs[0].ID)
+	assert.Equal(t, "rate limited", jobs[0].LastError)
+	assert.Equal(t, 8, jobs[0].Attempts)
+
+	rec = adminRequest(mux, http.MethodGet, "/admin/dead-letters/"+job.ID)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = adminRequest(mux, http.MethodGet, "/admin/dead-letters/00000000000000000000-000000000000")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminHandler_ReplayAndDiscard(t *testing.T) {
+	ctx := context.Background()
+	mux, q, job := newAdminTest(t)
+
+	rec := adminRequest(mux, http.MethodPost, "/admin/dead-letters/"+job.ID+"/replay")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	jobs, err := q.Claim(ctx, time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+
+	require.NoError(t, q.Bury(ctx, jobs[0], errors.New("still failing")))
+	rec = adminRequest(mux, http.MethodDelete, "/admin/dead-letters/"+job.ID)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	dead, err := q.DeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/guisithos/go-ride-names/internal/service"
+)
+
+const (
+	defaultPerPage = 30
+	maxPerPage     = 200
+)
+
+// handleListActivities serves GET /api/activities?page=&per_page=&before=&after=
+// so the browser never needs the athlete's Strava access token.
+func (h *WebHandler) handleListActivities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	athleteID, err := h.currentAthlete(r)
+	if err != nil {
+		log.Printf("No valid session: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	page, err := intParam(query.Get("page"), 1)
+	if err != nil || page < 1 {
+		http.Error(w, "Invalid page", http.StatusBadRequest)
+		return
+	}
+	perPage, err := intParam(query.Get("per_page"), defaultPerPage)
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		http.Error(w, fmt.Sprintf("per_page must be between 1 and %d", maxPerPage), http.StatusBadRequest)
+		return
+	}
+	before, err := int64Param(query.Get("before"))
+	if err != nil {
+		http.Error(w, "Invalid before", http.StatusBadRequest)
+		return
+	}
+	after, err := int64Param(query.Get("after"))
+	if err != nil {
+		http.Error(w, "Invalid after", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.store.LoadTokens(r.Context(), athleteID)
+	if err != nil {
+		log.Printf("Failed to load tokens for athlete %s: %v", athleteID, err)
+		status := tokenErrorStatus(err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	client := newStravaClient(h.store, h.stravaConfig, athleteID, tokens)
+	activityService := service.NewActivityService(client)
+
+	activities, err := activityService.ListActivities(r.Context(), page, perPage, before, after, false)
+	if err != nil {
+		log.Printf("Error listing activities for athlete %s: %v", athleteID, err)
+		if writeRateLimited(w, err) {
+			return
+		}
+		http.Error(w, "Failed to list activities", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(activities)
+}
+
+func intParam(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func int64Param(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/guisithos/go-ride-names/internal/storage"
+)
+
+// legacyWebhookActiveKey is where the dashboard used to record that an
+// athlete had turned on auto-rename
+func legacyWebhookActiveKey(athleteID string) string {
+	return fmt.Sprintf("webhook_active:%s", athleteID)
+}
+
+// loadAthleteSettings returns the athlete's settings, falling back to the
+// legacy webhook_active flag for athletes who never saved settings.
+func loadAthleteSettings(ctx context.Context, store storage.Store, athleteID string) (*storage.AthleteSettings, error) {
+	settings, err := storage.LoadAthleteSettings(ctx, store, athleteID)
+	if err == nil {
+		return settings, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	settings = &storage.AthleteSettings{}
+	var active bool
+	if err := store.Load(ctx, legacyWebhookActiveKey(athleteID), &active); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return settings, nil
+		}
+		log.Printf("Warning: ignoring legacy webhook status for athlete %s: %v", athleteID, err)
+		return settings, nil
+	}
+	settings.AutoRename = active
+	return settings, nil
+}
+
+// purgeAthlete deletes all stored data for an athlete
+func purgeAthlete(ctx context.Context, store storage.Store, athleteID string) error {
+	if err := storage.DeleteAthlete(ctx, store, athleteID); err != nil {
+		return err
+	}
+	return store.Delete(ctx, legacyWebhookActiveKey(athleteID))
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/auth"
+	"github.com/guisithos/go-ride-names/internal/config"
+	"github.com/guisithos/go-ride-names/internal/queue"
+	"github.com/guisithos/go-ride-names/internal/service"
+	"github.com/guisithos/go-ride-names/internal/storage"
+)
+
+const (
+	// defaultBackfillDays is how far back a backfill goes unless asked otherwise
+	defaultBackfillDays = 365
+	maxBackfillDays     = 10 * 365
+
+	// backfillPagesPerJob bounds one job run well within its lease; the rest
+	// of the history is handled by a follow-up job
+	backfillPagesPerJob = 2
+
+	// backfillStartGrace is how long a run without a job counts as running;
+	// after that the job was never queued and the run may be replaced
+	backfillStartGrace = time.Minute
+)
+
+// backfillState is the progress of an athlete's backfill
+type backfillState struct {
+	service.BackfillCursor
+	// Run numbers the athlete's backfills; jobs of an earlier run are dropped
+	Run int `json:"run,omitempty"`
+	// JobID is the queued job that carries the backfill on. Once it is gone
+	// without the backfill being done, e.g. dead-lettered, a new one may start.
+	JobID       string    `json:"job_id,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// backfillJob is the queue payload; the cursor itself lives in the store
+type backfillJob struct {
+	AthleteID string `json:"athlete_id"`
+	Run       int    `json:"run,omitempty"`
+}
+
+// backfillClaim is created under backfillRunKey by the request that starts
+// a run
+type backfillClaim struct {
+	ClaimedAt time.Time `json:"claimed_at"`
+}
+
+func backfillKey(athleteID string) string {
+	return fmt.Sprintf("athlete/%s/backfill.json", athleteID)
+}
+
+func backfillRunKey(athleteID string, run int) string {
+	return fmt.Sprintf("athlete/%s/backfill-runs/%d.json", athleteID, run)
+}
+
+// BackfillHandler renames the default-named activities in an athlete's
+// history in the background, resuming from a checkpoint after failures.
+type BackfillHandler struct {
+	store        storage.Store
+	stravaConfig *config.Config
+	sessions     *auth.SessionManager
+	queue        queue.Queue
+}
+
+func NewBackfillHandler(store storage.Store, stravaConfig *config.Config, sessions *auth.SessionManager, jobs queue.Queue) *BackfillHandler {
+	return &BackfillHandler{
+		store:        store,
+		stravaConfig: stravaConfig,
+		sessions:     sessions,
+		queue:        jobs,
+	}
+}
+
+func (h *BackfillHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/backfill", h.handleBackfill)
+}
+
+// handleBackfill serves
+//
+//	GET  /api/backfill         progress of the athlete's backfill
+//	POST /api/backfill?days=N  start renaming the last N days (default 365)
+func (h *BackfillHandler) handleBackfill(w http.ResponseWriter, r *http.Request) {
+	session, err := h.sessions.Get(r)
+	if err != nil {
+		log.Printf("No valid session: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	athleteID := session.AthleteID
+
+	switch r.Method {
+	case http.MethodGet:
+		var state backfillState
+		if err := h.store.Load(r.Context(), backfillKey(athleteID), &state); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, "No backfill started", http.StatusNotFound)
+				return
+			}
+			log.Printf("Error loading backfill for athlete %s: %v", athleteID, err)
+			http.Error(w, "Failed to load backfill", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, state)
+
+	case http.MethodPost:
+		if err := h.sessions.VerifyCSRF(r); err != nil {
+			log.Printf("CSRF check failed for %s: %v", r.URL.Path, err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		days, err := intParam(r.URL.Query().Get("days"), defaultBackfillDays)
+		if err != nil || days < 1 || days > maxBackfillDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxBackfillDays), http.StatusBadRequest)
+			return
+		}
+
+		state, err := h.start(r.Context(), athleteID, days)
+		if errors.Is(err, errBackfillRunning) {
+			http.Error(w, "A backfill is already running", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Error starting backfill for athlete %s: %v", athleteID, err)
+			http.Error(w, "Failed to start backfill", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(state)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+var errBackfillRunning = errors.New("backfill already running")
+
+// start saves a fresh cursor over the last days and queues the first job.
+// A backfill whose job has left the queue unfinished, e.g. dead-lettered, is
+// replaced.
+func (h *BackfillHandler) start(ctx context.Context, athleteID string, days int) (*backfillState, error) {
+	var current backfillState
+	err := h.store.Load(ctx, backfillKey(athleteID), &current)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && !current.Done {
+		// The request that started the run may still be queueing its job
+		running := current.JobID == "" && time.Since(current.StartedAt) < backfillStartGrace
+		if current.JobID != "" {
+			if running, err = h.queue.Pending(ctx, current.JobID); err != nil {
+				return nil, err
+			}
+		}
+		if running {
+			return nil, errBackfillRunning
+		}
+		log.Printf("Replacing stalled backfill run %d for athlete %s", current.Run, athleteID)
+	}
+
+	// Concurrent requests read the same run; only one can claim the next
+	now := time.Now().UTC()
+	run := current.Run + 1
+	claimed, err := h.store.Create(ctx, backfillRunKey(athleteID, run), backfillClaim{ClaimedAt: now})
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, errBackfillRunning
+	}
+	if current.Run > 0 {
+		if err := h.store.Delete(ctx, backfillRunKey(athleteID, current.Run)); err != nil {
+			log.Printf("Warning: failed to remove backfill run %d for athlete %s: %v", current.Run, athleteID, err)
+		}
+	}
+
+	state := &backfillState{
+		BackfillCursor: service.BackfillCursor{
+			Before:   now.Unix(),
+			After:    now.AddDate(0, 0, -days).Unix(),
+			NextPage: 1,
+		},
+		Run:       run,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	if err := h.store.Set(ctx, backfillKey(athleteID), state); err != nil {
+		return nil, err
+	}
+	if err := h.enqueue(ctx, athleteID, state); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Started %d-day backfill for athlete %s", days, athleteID)
+	return state, nil
+}
+
+// enqueue queues the next job of the backfill and records it in the state
+func (h *BackfillHandler) enqueue(ctx context.Context, athleteID string, state *backfillState) error {
+	job, err := h.queue.Enqueue(ctx, backfillJob{AthleteID: athleteID, Run: state.Run})
+	if err != nil {
+		return err
+	}
+	state.JobID = job.ID
+	return h.store.Set(ctx, backfillKey(athleteID), state)
+}
+
+// ProcessJob advances an athlete's backfill by up to backfillPagesPerJob
+// pages and queues a follow-up job while history remains.
+func (h *BackfillHandler) ProcessJob(ctx context.Context, job *queue.Job) error {
+	var payload backfillJob
+	if err := job.Decode(&payload); err != nil {
+		return queue.Permanent(fmt.Errorf("invalid backfill job %s: %v", job.ID, err))
+	}
+	athleteID := payload.AthleteID
+
+	var state backfillState
+	if err := h.store.Load(ctx, backfillKey(athleteID), &state); err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrCorrupt) {
+			return queue.Permanent(fmt.Errorf("no backfill for athlete %s: %w", athleteID, err))
+		}
+		return fmt.Errorf("failed to load backfill for athlete %s: %v", athleteID, err)
+	}
+	if state.Done || payload.Run != state.Run {
+		return nil // finished, or left over from a replaced run
+	}
+
+	tokens, err := h.store.LoadTokens(ctx, athleteID)
+	if err != nil {
+		err = fmt.Errorf("failed to load tokens for athlete %s: %w", athleteID, err)
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrCorrupt) {
+			return queue.Permanent(err)
+		}
+		return err
+	}
+
+	client := newStravaClient(h.store, h.stravaConfig, athleteID, tokens)
+	activityService := service.NewActivityService(client)
+	activityService.OnRename(renameRecorder(h.store, athleteID, storage.RenameSourceBackfill))
+	activityService.SkipUndone(undoneCheck(h.store, athleteID))
+
+	checkpoint := func(ctx context.Context, cursor *service.BackfillCursor) error {
+		state.BackfillCursor = *cursor
+		state.UpdatedAt = time.Now().UTC()
+		state.LastError = ""
+		if cursor.Done {
+			state.CompletedAt = state.UpdatedAt
+		}
+		return h.store.Set(ctx, backfillKey(athleteID), state)
+	}
+
+	cursor := state.BackfillCursor
+	if err := activityService.Backfill(ctx, &cursor, backfillPagesPerJob, checkpoint); err != nil {
+		state.LastError = err.Error()
+		if err := h.store.Set(ctx, backfillKey(athleteID), state); err != nil {
+			log.Printf("Warning: failed to record backfill error for athlete %s: %v", athleteID, err)
+		}
+		return stravaJobError(fmt.Errorf("backfill for athlete %s stopped at page %d: %w", athleteID, state.NextPage, err))
+	}
+
+	if cursor.Done {
+		log.Printf("Backfill for athlete %s done: %d scanned, %d renamed", athleteID, cursor.Scanned, cursor.Renamed)
+		return nil
+	}
+
+	if err := h.enqueue(ctx, athleteID, &state); err != nil {
+		return fmt.Errorf("failed to queue next backfill job for athlete %s: %v", athleteID, err)
+	}
+	return nil
+}
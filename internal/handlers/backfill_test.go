@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/guisithos/go-ride-names/internal/config"
+	"github.com/guisithos/go-ride-names/internal/queue"
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Requests racing to start a backfill start exactly one
+func TestBackfillHandler_StartsOnce(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	jobs := queue.NewStoreQueue(store, "backfill")
+	handler := NewBackfillHandler(store, &config.Config{}, nil, jobs)
+
+	var mu sync.Mutex
+	started, running := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := handler.start(ctx, "9", 30)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				started++
+			case err == errBackfillRunning:
+				running++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, started)
+	assert.Equal(t, 9, running)
+	pending, err := store.List(ctx, "queue/backfill/")
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
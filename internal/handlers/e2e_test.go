@@ -0,0 +1,664 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/auth"
+	"github.com/guisithos/go-ride-names/internal/config"
+	"github.com/guisithos/go-ride-names/internal/queue"
+	"github.com/guisithos/go-ride-names/internal/service"
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/guisithos/go-ride-names/internal/strava"
+	"github.com/guisithos/go-ride-names/internal/strava/stravatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// e2e runs the app's handlers against a fake Strava. The app is served over
+// TLS because session cookies are Secure.
+type e2e struct {
+	fake     *stravatest.Server
+	app      *httptest.Server
+	cfg      *config.Config
+	store    storage.Store
+	sessions *auth.SessionManager
+	// subscriptions reconciles the push subscription webhooks are checked against
+	subscriptions *service.WebhookService
+	worker        *queue.Worker
+	backfill      *queue.Worker
+	browser       *http.Client
+}
+
+// renameResponse is the body of a rename or undo report
+type renameResponse struct {
+	Success bool                 `json:"success"`
+	Renamed int                  `json:"renamed"`
+	Skipped int                  `json:"skipped"`
+	Failed  int                  `json:"failed"`
+	Results service.RenameReport `json:"results"`
+}
+
+// outcomeReasons maps the activities in outcomes to the reason given for each
+func outcomeReasons(outcomes []service.RenameOutcome) map[int64]string {
+	reasons := map[int64]string{}
+	for _, outcome := range outcomes {
+		reasons[outcome.ActivityID] = outcome.Reason
+	}
+	return reasons
+}
+
+func newE2E(t *testing.T) *e2e {
+	t.Helper()
+	fake := stravatest.NewServer()
+	t.Cleanup(fake.Close)
+
+	mux := http.NewServeMux()
+	app := httptest.NewTLSServer(mux)
+	t.Cleanup(app.Close)
+	fake.CallbackClient = app.Client()
+
+	cfg := &config.Config{
+		StravaClientID:     stravatest.ClientID,
+		StravaClientSecret: stravatest.ClientSecret,
+		BaseURL:            app.URL,
+	}
+	cfg.OAuth.RedirectURI = app.URL + "/callback"
+	cfg.Strava.APIURL = fake.APIURL()
+	cfg.Strava.OAuthURL = fake.OAuthURL()
+	cfg.Strava.Timeout = 5 * time.Second
+	cfg.Webhook.CallbackURL = app.URL + "/webhook"
+	cfg.Webhook.VerifyToken = "e2e-verify"
+
+	store := storage.NewMemoryStore()
+	sessions := auth.NewSessionManager(testSessionSecret, time.Hour)
+
+	oauthHandler := auth.NewOAuthHandler(cfg, store, sessions)
+	oauthHandler.RegisterRoutes(mux)
+	events := queue.NewStoreQueue(store, "webhook")
+	client := strava.NewClient("", "", cfg.StravaClientID, cfg.StravaClientSecret, StravaOptions(cfg)...)
+	subscriptions := service.NewWebhookService(client, cfg.Webhook.CallbackURL, cfg.Webhook.VerifyToken)
+	webhookHandler := NewWebhookHandler(store, cfg, events, subscriptions)
+	webhookHandler.RegisterRoutes(mux)
+	NewWebHandler(store, oauthHandler.GetConfig(), cfg, nil, sessions).RegisterRoutes(mux)
+	backfillJobs := queue.NewStoreQueue(store, "backfill")
+	backfillHandler := NewBackfillHandler(store, cfg, sessions, backfillJobs)
+	backfillHandler.RegisterRoutes(mux)
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	browser := app.Client()
+	browser.Jar = jar
+	// Stop at the dashboard, which needs templates
+	browser.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Path == "/dashboard" {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+
+	return &e2e{
+		fake:          fake,
+		app:           app,
+		cfg:           cfg,
+		store:         store,
+		sessions:      sessions,
+		subscriptions: subscriptions,
+		worker:        queue.NewWorker(events, webhookHandler.ProcessJob, queue.WorkerOptions{}),
+		backfill:      queue.NewWorker(backfillJobs, backfillHandler.ProcessJob, queue.WorkerOptions{}),
+		browser:       browser,
+	}
+}
+
+// login goes through /auth, the fake's approval and /callback
+func (e *e2e) login(t *testing.T) {
+	t.Helper()
+	resp, err := e.browser.Get(e.app.URL + "/auth")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	require.Equal(t, "/dashboard", resp.Header.Get("Location"))
+}
+
+// post sends a state-changing request from the logged-in browser
+func (e *e2e) post(t *testing.T, path string) *http.Response {
+	t.Helper()
+	return e.postJSON(t, path, nil)
+}
+
+// postJSON is post with a JSON body, unless body is nil
+func (e *e2e) postJSON(t *testing.T, path string, body interface{}) *http.Response {
+	t.Helper()
+	appURL, err := url.Parse(e.app.URL)
+	require.NoError(t, err)
+	sessionReq := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range e.browser.Jar.Cookies(appURL) {
+		sessionReq.AddCookie(cookie)
+	}
+	session, err := e.sessions.Get(sessionReq)
+	require.NoError(t, err)
+
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		require.NoError(t, err)
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(http.MethodPost, e.app.URL+path, reqBody)
+	require.NoError(t, err)
+	req.Header.Set(auth.CSRFHeader, e.sessions.CSRFToken(session))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := e.browser.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestEndToEnd_LoginRenameAndWebhook(t *testing.T) {
+	e := newE2E(t)
+	ctx := context.Background()
+
+	e.fake.AddAthlete(strava.Athlete{ID: 42, FirstName: "Ana"})
+	morning := e.fake.AddActivity(42, strava.Activity{Name: "Morning Run", SportType: "Run"})
+	custom := e.fake.AddActivity(42, strava.Activity{Name: "Hill repeats", SportType: "Run"})
+
+	// Login stores the athlete's tokens
+	e.login(t)
+	tokens, err := e.store.LoadTokens(ctx, "42")
+	require.NoError(t, err)
+	firstRefresh := tokens.RefreshToken
+
+	// Renaming recent activities only touches default names
+	resp := e.post(t, "/rename-activities")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var report renameResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, 1, report.Renamed)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 0, report.Failed)
+	assert.Equal(t, morning.ID, report.Results.Renamed[0].ActivityID)
+	assert.Equal(t, service.ReasonNotDefaultName, report.Results.Skipped[0].Reason)
+	renamed, _ := e.fake.Activity(morning.ID)
+	untouched, _ := e.fake.Activity(custom.ID)
+	assert.NotEqual(t, "Morning Run", renamed.Name)
+	assert.Equal(t, "Hill repeats", untouched.Name)
+
+	// The app subscribes to push events; the fake validates our callback
+	status, err := e.subscriptions.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, service.SubscriptionCreated, status.Action)
+
+	resp = e.post(t, "/subscribe")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// A new upload arrives while the access token has expired and Strava
+	// is briefly failing
+	ride := e.fake.AddActivity(42, strava.Activity{Name: "Evening Ride", SportType: "Ride"})
+	ridePath := fmt.Sprintf("/api/v3/activities/%d", ride.ID)
+	e.fake.ExpireAccessTokens(42)
+	e.fake.InjectFailure(stravatest.Failure{
+		Method: http.MethodGet,
+		Path:   ridePath,
+		Status: http.StatusBadGateway,
+	})
+	require.NoError(t, e.fake.Notify(ctx, stravatest.ActivityCreated(42, ride.ID)))
+
+	n, err := e.worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, _ := e.fake.Activity(ride.ID)
+	assert.NotEqual(t, "Evening Ride", got.Name)
+
+	tokens, err = e.store.LoadTokens(ctx, "42")
+	require.NoError(t, err)
+	assert.NotEqual(t, firstRefresh, tokens.RefreshToken, "the rotated refresh token must be persisted")
+
+	// A redelivery is acknowledged but not processed again
+	require.NoError(t, e.fake.Notify(ctx, stravatest.ActivityCreated(42, ride.ID)))
+	n, err = e.worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 1, e.fake.Requests(http.MethodPut, ridePath))
+
+	// A forged deauthorization is refused, and one Strava sends while the
+	// athlete's tokens still work purges nothing
+	forged := stravatest.Deauthorized(42)
+	forged.SubscriptionID = status.Subscription.ID + 1
+	assert.Error(t, e.fake.SendEvent(ctx, e.cfg.Webhook.CallbackURL, forged))
+	require.NoError(t, e.fake.Notify(ctx, stravatest.Deauthorized(42)))
+	_, err = e.worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	_, err = e.store.LoadTokens(ctx, "42")
+	require.NoError(t, err)
+
+	// Revoking access on strava.com purges the athlete
+	e.fake.Revoke(42)
+	require.NoError(t, e.fake.Notify(ctx, stravatest.Deauthorized(42)))
+	_, err = e.worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	_, err = e.store.LoadTokens(ctx, "42")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestEndToEnd_Disconnect(t *testing.T) {
+	e := newE2E(t)
+	ctx := context.Background()
+	e.fake.AddAthlete(strava.Athlete{ID: 7})
+
+	e.login(t)
+	require.True(t, e.fake.Authorized(7))
+
+	resp := e.post(t, "/disconnect")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, e.fake.Authorized(7), "access must be revoked on Strava")
+	_, err := e.store.LoadTokens(ctx, "7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestEndToEnd_RenameActivitiesWalksEveryPage(t *testing.T) {
+	e := newE2E(t)
+	e.fake.AddAthlete(strava.Athlete{ID: 11})
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < service.DefaultPageSize; i++ {
+		e.fake.AddActivity(11, strava.Activity{Name: fmt.Sprintf("Training %d", i), SportType: "Run", StartDate: start.Add(-time.Duration(i) * time.Minute)})
+	}
+	// Beyond the first page, but inside the window
+	older := e.fake.AddActivity(11, strava.Activity{Name: "Morning Run", SportType: "Run", StartDate: start.AddDate(0, 0, -10)})
+	// Outside the window
+	oldest := e.fake.AddActivity(11, strava.Activity{Name: "Morning Run", SportType: "Run", StartDate: start.AddDate(0, 0, -40)})
+
+	e.login(t)
+	resp := e.post(t, "/rename-activities?days=30")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var report struct {
+		Renamed int `json:"renamed"`
+		Skipped int `json:"skipped"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, 1, report.Renamed)
+	assert.Equal(t, service.DefaultPageSize, report.Skipped)
+
+	renamed, _ := e.fake.Activity(older.ID)
+	assert.NotEqual(t, "Morning Run", renamed.Name)
+	untouched, _ := e.fake.Activity(oldest.ID)
+	assert.Equal(t, "Morning Run", untouched.Name)
+
+	resp = e.post(t, "/rename-activities?days=0")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestEndToEnd_Backfill(t *testing.T) {
+	e := newE2E(t)
+	ctx := context.Background()
+	e.fake.AddAthlete(strava.Athlete{ID: 9})
+
+	// More than one job's worth of pages; only every tenth keeps its default name
+	start := time.Now().Add(-time.Hour)
+	var defaults []int64
+	for i := 0; i < 2*backfillPagesPerJob*service.DefaultPageSize+10; i++ {
+		name := fmt.Sprintf("Training %d", i)
+		if i%10 == 0 {
+			name = "Morning Run"
+		}
+		activity := e.fake.AddActivity(9, strava.Activity{Name: name, SportType: "Run", StartDate: start.Add(-time.Duration(i) * time.Hour)})
+		if i%10 == 0 {
+			defaults = append(defaults, activity.ID)
+		}
+	}
+	old := e.fake.AddActivity(9, strava.Activity{Name: "Morning Run", SportType: "Run", StartDate: start.AddDate(-2, 0, 0)})
+
+	e.login(t)
+	resp := e.post(t, "/api/backfill")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	resp = e.post(t, "/api/backfill")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Each job handles a few pages and queues the next one
+	for jobs := 0; jobs < 3; jobs++ {
+		n, err := e.backfill.ProcessDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+	n, err := e.backfill.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	var state backfillState
+	require.NoError(t, e.store.Load(ctx, backfillKey("9"), &state))
+	assert.True(t, state.Done)
+	assert.False(t, state.CompletedAt.IsZero())
+	assert.Equal(t, 2*backfillPagesPerJob*service.DefaultPageSize+10, state.Scanned)
+	assert.Equal(t, len(defaults), state.Renamed)
+
+	for _, id := range defaults {
+		activity, _ := e.fake.Activity(id)
+		assert.NotEqual(t, "Morning Run", activity.Name)
+	}
+	untouched, _ := e.fake.Activity(old.ID)
+	assert.Equal(t, "Morning Run", untouched.Name, "activities outside the window are left alone")
+
+	// Once done, another backfill can be started
+	resp = e.post(t, "/api/backfill?days=30")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
+
+// A backfill whose job was dead-lettered can be started again, and its old
+// job is dropped if replayed
+func TestEndToEnd_BackfillRestartsAfterDeadLetter(t *testing.T) {
+	e := newE2E(t)
+	ctx := context.Background()
+	e.fake.AddAthlete(strava.Athlete{ID: 9})
+	e.login(t)
+
+	resp := e.post(t, "/api/backfill")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	jobs := queue.NewStoreQueue(e.store, "backfill")
+	claimed, err := jobs.Claim(ctx, time.Now(), 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, jobs.Bury(ctx, claimed[0], fmt.Errorf("boom")))
+
+	resp = e.post(t, "/api/backfill")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp = e.post(t, "/api/backfill")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	var state backfillState
+	require.NoError(t, e.store.Load(ctx, backfillKey("9"), &state))
+	assert.Equal(t, 2, state.Run)
+
+	_, err = jobs.Replay(ctx, claimed[0].ID)
+	require.NoError(t, err)
+	for {
+		n, err := e.backfill.ProcessDue(ctx)
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+	require.NoError(t, e.store.Load(ctx, backfillKey("9"), &state))
+	assert.True(t, state.Done)
+	assert.Equal(t, 2, state.Run)
+}
+
+func TestEndToEnd_RenamePreview(t *testing.T) {
+	e := newE2E(t)
+	e.fake.AddAthlete(strava.Athlete{ID: 5})
+	morning := e.fake.AddActivity(5, strava.Activity{Name: "Morning Run", SportType: "Run"})
+	lunch := e.fake.AddActivity(5, strava.Activity{Name: "Lunch Ride", SportType: "Ride"})
+	e.fake.AddActivity(5, strava.Activity{Name: "Hill repeats", SportType: "Run"})
+	e.login(t)
+
+	// The preview proposes names for default-named activities only and
+	// renames nothing
+	resp := e.post(t, "/api/rename/preview")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var plan renamePlan
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&plan))
+	require.Len(t, plan.Items, 2)
+	proposed := make(map[int64]service.RenameProposal)
+	for _, item := range plan.Items {
+		proposed[item.ActivityID] = item
+	}
+	assert.Equal(t, "Morning Run", proposed[morning.ID].OldName)
+	assert.Equal(t, service.Run, proposed[morning.ID].Type)
+	assert.Equal(t, 0, e.fake.Requests(http.MethodPut, fmt.Sprintf("/api/v3/activities/%d", morning.ID)))
+
+	resp = e.postJSON(t, "/api/rename/reroll", renameSelection{ActivityIDs: []int64{morning.ID}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var rerolled struct {
+		Items []service.RenameProposal `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rerolled))
+	require.Len(t, rerolled.Items, 1)
+	assert.NotEqual(t, proposed[morning.ID].NewName, rerolled.Items[0].NewName)
+
+	// Only accepted items are applied, with the rerolled name
+	resp = e.postJSON(t, "/api/rename/apply", renameSelection{ActivityIDs: []int64{morning.ID}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, float64(1), result["renamed"])
+	assert.Equal(t, float64(1), result["skipped"])
+	assert.Equal(t, float64(0), result["failed"])
+
+	renamed, _ := e.fake.Activity(morning.ID)
+	assert.Equal(t, rerolled.Items[0].NewName, renamed.Name)
+	skipped, _ := e.fake.Activity(lunch.ID)
+	assert.Equal(t, "Lunch Ride", skipped.Name)
+
+	// A preview is applied once
+	resp = e.postJSON(t, "/api/rename/apply", renameSelection{ActivityIDs: []int64{lunch.ID}})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// A title the athlete typed after the preview is kept
+	resp = e.post(t, "/api/rename/preview")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	lunch.Name = "Ride to the lake"
+	e.fake.AddActivity(5, lunch)
+	resp = e.postJSON(t, "/api/rename/apply", renameSelection{ActivityIDs: []int64{lunch.ID}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var report struct {
+		Results service.RenameReport `json:"results"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Empty(t, report.Results.Renamed)
+	assert.Equal(t, []service.RenameOutcome{{ActivityID: lunch.ID, OldName: "Lunch Ride", Reason: service.ReasonNameChanged}}, report.Results.Skipped)
+	kept, _ := e.fake.Activity(lunch.ID)
+	assert.Equal(t, "Ride to the lake", kept.Name)
+}
+
+// A subscription replaced after startup, e.g. by the admin CLI, is picked up
+// from Strava instead of refusing its events
+func TestEndToEnd_WebhookAfterSubscriptionReplaced(t *testing.T) {
+	ctx := context.Background()
+	e := newE2E(t)
+	e.fake.AddAthlete(strava.Athlete{ID: 42})
+	e.login(t)
+
+	status, err := e.subscriptions.Reconcile(ctx)
+	require.NoError(t, err)
+	client := strava.NewClient("", "", e.cfg.StravaClientID, e.cfg.StravaClientSecret, StravaOptions(e.cfg)...)
+	require.NoError(t, client.DeleteWebhookSubscription(ctx, status.Subscription.ID))
+	replaced, err := client.CreateWebhookSubscription(ctx, e.cfg.Webhook.CallbackURL, e.cfg.Webhook.VerifyToken)
+	require.NoError(t, err)
+	require.NotEqual(t, status.Subscription.ID, replaced.ID)
+
+	resp := e.post(t, "/subscribe")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	ride := e.fake.AddActivity(42, strava.Activity{Name: "Morning Ride", SportType: "Ride"})
+	require.NoError(t, e.fake.Notify(ctx, stravatest.ActivityCreated(42, ride.ID)))
+	n, err := e.worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, _ := e.fake.Activity(ride.ID)
+	assert.NotEqual(t, "Morning Ride", got.Name)
+	assert.Equal(t, replaced.ID, e.subscriptions.LastStatus().Subscription.ID)
+}
+
+func TestEndToEnd_HistoryAndUndo(t *testing.T) {
+	e := newE2E(t)
+	e.fake.AddAthlete(strava.Athlete{ID: 3})
+	morning := e.fake.AddActivity(3, strava.Activity{Name: "Morning Run", SportType: "Run"})
+	evening := e.fake.AddActivity(3, strava.Activity{Name: "Evening Walk", SportType: "Walk"})
+	e.login(t)
+
+	resp := e.post(t, "/rename-activities")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err := e.browser.Get(e.app.URL + "/api/renames")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var records []storage.RenameRecord
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&records))
+	require.Len(t, records, 2)
+	for _, record := range records {
+		assert.Equal(t, storage.RenameSourceManual, record.Source)
+		assert.NotEmpty(t, record.JokeID)
+		current, _ := e.fake.Activity(record.ActivityID)
+		assert.Equal(t, current.Name, record.NewName)
+	}
+
+	// Undo one activity
+	resp = e.postJSON(t, "/api/renames/undo", undoRequest{ActivityIDs: []int64{morning.ID}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	restored, _ := e.fake.Activity(morning.ID)
+	assert.Equal(t, "Morning Run", restored.Name)
+
+	// The athlete renames the other one on Strava; a bulk undo leaves it be
+	edited, _ := e.fake.Activity(evening.ID)
+	edited.Name = "Walk with the dog"
+	e.fake.AddActivity(3, edited)
+
+	now := time.Now().UTC()
+	resp = e.postJSON(t, "/api/renames/undo", undoRequest{
+		From: now.AddDate(0, 0, -1).Format(dateLayout),
+		To:   now.Format(dateLayout),
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result renameResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Empty(t, result.Results.Renamed)
+	assert.Empty(t, result.Results.Failed)
+	assert.Equal(t, map[int64]string{
+		morning.ID: service.ReasonAlreadyUndone,
+		evening.ID: service.ReasonNameChanged,
+	}, outcomeReasons(result.Results.Skipped))
+	current, _ := e.fake.Activity(evening.ID)
+	assert.Equal(t, "Walk with the dog", current.Name)
+}
+
+// An activity renamed twice gets back the name it had before the first rename
+func TestEndToEnd_UndoRestoresFirstName(t *testing.T) {
+	e := newE2E(t)
+	e.fake.AddAthlete(strava.Athlete{ID: 3})
+	activity := e.fake.AddActivity(3, strava.Activity{Name: "Morning Run", SportType: "Run"})
+	e.login(t)
+
+	resp := e.post(t, "/rename-activities")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The athlete puts a default name back and it is renamed again
+	edited, _ := e.fake.Activity(activity.ID)
+	edited.Name = "Afternoon Run"
+	e.fake.AddActivity(3, edited)
+	resp = e.post(t, "/rename-activities")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	records, err := storage.ActivityRenames(context.Background(), e.store, "3", activity.ID)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "Morning Run", records[0].OriginalName)
+	assert.Equal(t, "Afternoon Run", records[1].OriginalName)
+
+	resp = e.postJSON(t, "/api/renames/undo", undoRequest{ActivityIDs: []int64{activity.ID}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	restored, _ := e.fake.Activity(activity.ID)
+	assert.Equal(t, "Morning Run", restored.Name)
+
+	records, err = storage.ActivityRenames(context.Background(), e.store, "3", activity.ID)
+	require.NoError(t, err)
+	for _, record := range records {
+		assert.NotNil(t, record.UndoneAt)
+	}
+}
+
+// An activity whose rename was undone keeps its restored name on every path
+// that renames
+func TestEndToEnd_UndoneActivityIsNotRenamedAgain(t *testing.T) {
+	ctx := context.Background()
+	e := newE2E(t)
+	e.fake.AddAthlete(strava.Athlete{ID: 3})
+	activity := e.fake.AddActivity(3, strava.Activity{Name: "Morning Run", SportType: "Run"})
+	e.login(t)
+
+	resp := e.post(t, "/rename-activities")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = e.postJSON(t, "/api/renames/undo", undoRequest{ActivityIDs: []int64{activity.ID}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = e.post(t, "/rename-activities")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result renameResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Empty(t, result.Results.Renamed)
+	assert.Equal(t, []service.RenameOutcome{{ActivityID: activity.ID, OldName: "Morning Run", Reason: service.ReasonUndone}}, result.Results.Skipped)
+
+	resp = e.post(t, "/api/rename/preview")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var plan renamePlan
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&plan))
+	assert.Empty(t, plan.Items)
+
+	resp = e.post(t, "/api/backfill")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	_, err := e.backfill.ProcessDue(ctx)
+	require.NoError(t, err)
+	var state backfillState
+	require.NoError(t, e.store.Load(ctx, backfillKey("3"), &state))
+	assert.True(t, state.Done)
+	assert.Equal(t, 0, state.Renamed)
+
+	kept, _ := e.fake.Activity(activity.ID)
+	assert.Equal(t, "Morning Run", kept.Name)
+}
+
+// A bulk undo stopped by Strava's rate limit reports what it got done
+func TestEndToEnd_UndoRateLimited(t *testing.T) {
+	// The 429 exhausts the limits for the rest of the day; keep it away
+	// from the other tests
+	limiter := strava.DefaultRateLimiter
+	strava.DefaultRateLimiter = strava.NewRateLimiter()
+	t.Cleanup(func() { strava.DefaultRateLimiter = limiter })
+
+	e := newE2E(t)
+	e.fake.AddAthlete(strava.Athlete{ID: 3})
+	first := e.fake.AddActivity(3, strava.Activity{Name: "Morning Run", SportType: "Run"})
+	second := e.fake.AddActivity(3, strava.Activity{Name: "Lunch Ride", SportType: "Ride"})
+	third := e.fake.AddActivity(3, strava.Activity{Name: "Evening Walk", SportType: "Walk"})
+	e.login(t)
+
+	resp := e.post(t, "/rename-activities")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	e.fake.InjectFailure(stravatest.Failure{
+		Method: http.MethodPut,
+		Path:   fmt.Sprintf("/api/v3/activities/%d", second.ID),
+		Status: http.StatusTooManyRequests,
+	})
+	resp = e.postJSON(t, "/api/renames/undo", undoRequest{ActivityIDs: []int64{first.ID, second.ID, third.ID}})
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	var result renameResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(t, result.Results.Renamed, 1)
+	assert.Equal(t, first.ID, result.Results.Renamed[0].ActivityID)
+	assert.Equal(t, "Morning Run", result.Results.Renamed[0].NewName)
+	assert.Empty(t, result.Results.Skipped)
+	assert.Equal(t, map[int64]string{
+		second.ID: service.ReasonRateLimited,
+		third.ID:  service.ReasonRateLimited,
+	}, outcomeReasons(result.Results.Failed))
+
+	restored, _ := e.fake.Activity(first.ID)
+	assert.Equal(t, "Morning Run", restored.Name)
+	renamed, _ := e.fake.Activity(third.ID)
+	assert.NotEqual(t, "Evening Walk", renamed.Name)
+}
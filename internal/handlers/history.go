@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/service"
+	"github.com/guisithos/go-ride-names/internal/storage"
+)
+
+// dateLayout is the format of the from and to dates of the history API
+const dateLayout = "2006-01-02"
+
+// undoRequest selects the activities to restore: the listed ones, or
+// otherwise every activity renamed between From and To (inclusive dates)
+type undoRequest struct {
+	ActivityIDs []int64 `json:"activity_ids"`
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+}
+
+// renameRecorder returns a hook that records every rename in the athlete's
+// history. A rename that cannot be recorded has still happened on Strava, so
+// the failure is only logged.
+func renameRecorder(store storage.Store, athleteID, source string) service.RenameHook {
+	return func(ctx context.Context, rename service.Rename) {
+		record := &storage.RenameRecord{
+			ActivityID:   rename.ActivityID,
+			OriginalName: rename.OldName,
+			NewName:      rename.NewName,
+			JokeID:       rename.JokeID,
+			Source:       source,
+			RenamedAt:    time.Now().UTC(),
+		}
+		if err := storage.SaveRename(ctx, store, athleteID, record); err != nil {
+			log.Printf("Warning: failed to record rename of activity %d: %v", rename.ActivityID, err)
+		}
+	}
+}
+
+// undoneCheck returns a check that tells whether the athlete undid our latest
+// rename of an activity
+func undoneCheck(store storage.Store, athleteID string) service.UndoneFunc {
+	return func(ctx context.Context, activityID int64) (bool, error) {
+		record, err := storage.LatestRename(ctx, store, athleteID, activityID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return record.UndoneAt != nil, nil
+	}
+}
+
+// dateRange parses inclusive from and to dates into [from, to). Empty dates
+// leave the range open.
+func dateRange(fromDate, toDate string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if fromDate != "" {
+		if from, err = time.Parse(dateLayout, fromDate); err != nil {
+			return from, to, err
+		}
+	}
+	if toDate != "" {
+		if to, err = time.Parse(dateLayout, toDate); err != nil {
+			return from, to, err
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+func (h *WebHandler) handleHistory(w http.ResponseWriter, r *http.Request) {
+	h.renderAthletePage(w, r, "history.html")
+}
+
+// handleListRenames serves GET /api/renames?from=YYYY-MM-DD&to=YYYY-MM-DD
+func (h *WebHandler) handleListRenames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	athleteID, err := h.currentAthlete(r)
+	if err != nil {
+		log.Printf("No valid session: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	from, to, err := dateRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "from and to must be dates like 2006-01-02", http.StatusBadRequest)
+		return
+	}
+
+	records, err := storage.ListRenames(r.Context(), h.store, athleteID, from, to)
+	if err != nil {
+		log.Printf("Error listing renames for athlete %s: %v", athleteID, err)
+		http.Error(w, "Failed to load history", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, records)
+}
+
+// pendingRenames returns the renames of an activity made since it was last
+// undone, oldest first
+func pendingRenames(records []storage.RenameRecord) []storage.RenameRecord {
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].UndoneAt != nil {
+			return records[i+1:]
+		}
+	}
+	return records
+}
+
+// handleUndoRenames serves POST /api/renames/undo. It restores the original
+// names of the selected activities, leaving alone those the athlete has
+// renamed since.
+func (h *WebHandler) handleUndoRenames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.checkCSRF(w, r) {
+		return
+	}
+
+	athleteID, err := h.currentAthlete(r)
+	if err != nil {
+		log.Printf("No valid session: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req undoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.ActivityIDs) == 0 && req.From == "" && req.To == "" {
+		http.Error(w, "Select activity_ids or a from/to date range", http.StatusBadRequest)
+		return
+	}
+
+	// Every rename of an activity is kept, so an undo selects activities
+	activityIDs := req.ActivityIDs
+	if len(activityIDs) == 0 {
+		from, to, err := dateRange(req.From, req.To)
+		if err != nil {
+			http.Error(w, "from and to must be dates like 2006-01-02", http.StatusBadRequest)
+			return
+		}
+		records, err := storage.ListRenames(r.Context(), h.store, athleteID, from, to)
+		if err != nil {
+			log.Printf("Error listing renames for athlete %s: %v", athleteID, err)
+			http.Error(w, "Failed to load history", http.StatusInternalServerError)
+			return
+		}
+		seen := map[int64]bool{}
+		for _, record := range records {
+			if !seen[record.ActivityID] {
+				seen[record.ActivityID] = true
+				activityIDs = append(activityIDs, record.ActivityID)
+			}
+		}
+	}
+
+	histories := [][]storage.RenameRecord{}
+	for _, id := range activityIDs {
+		records, err := storage.ActivityRenames(r.Context(), h.store, athleteID, id)
+		if err != nil {
+			log.Printf("Error loading renames of activity %d: %v", id, err)
+			http.Error(w, "Failed to load history", http.StatusInternalServerError)
+			return
+		}
+		if len(records) > 0 {
+			histories = append(histories, records)
+		}
+	}
+
+	tokens, err := h.store.LoadTokens(r.Context(), athleteID)
+	if err != nil {
+		log.Printf("Failed to load tokens for athlete %s: %v", athleteID, err)
+		status := tokenErrorStatus(err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	client := newStravaClient(h.store, h.stravaConfig, athleteID, tokens)
+	activityService := service.NewActivityService(client)
+
+	report := service.NewRenameReport()
+	restores := []service.Restore{}
+	pendingByActivity := map[int64][]storage.RenameRecord{}
+	for _, records := range histories {
+		activityID := records[0].ActivityID
+		pending := pendingRenames(records)
+		if len(pending) == 0 {
+			latest := records[len(records)-1]
+			report.Skipped = append(report.Skipped, service.RenameOutcome{ActivityID: activityID, OldName: latest.NewName, Reason: service.ReasonAlreadyUndone})
+			continue
+		}
+		// The activity has the latest name we gave it and gets back the one
+		// it had before the first
+		pendingByActivity[activityID] = pending
+		restores = append(restores, service.Restore{
+			ActivityID: activityID,
+			RenamedTo:  pending[len(pending)-1].NewName,
+			Original:   pending[0].OriginalName,
+		})
+	}
+
+	restored, err := activityService.RestoreNames(r.Context(), restores)
+	report.Renamed = restored.Renamed
+	report.Skipped = append(report.Skipped, restored.Skipped...)
+	report.Failed = restored.Failed
+
+	now := time.Now().UTC()
+	for _, outcome := range restored.Renamed {
+		pending := pendingByActivity[outcome.ActivityID]
+		for i := range pending {
+			pending[i].UndoneAt = &now
+			if err := storage.SaveRename(r.Context(), h.store, athleteID, &pending[i]); err != nil {
+				// The name is restored; a second undo finds it changed and skips it
+				log.Printf("Warning: failed to record undo of activity %d: %v", outcome.ActivityID, err)
+			}
+		}
+	}
+
+	if err != nil {
+		log.Printf("Undo for athlete %s stopped after %d renames: %v", athleteID, len(report.Renamed), err)
+	} else {
+		log.Printf("Undid %d renames for athlete %s", len(report.Renamed), athleteID)
+	}
+	writeRenameReport(w, report, err)
+}
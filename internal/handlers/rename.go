@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/service"
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/guisithos/go-ride-names/internal/strava"
+)
+
+// renamePlanTTL is how long a preview can be applied; after that the
+// activities may have been renamed elsewhere
+const renamePlanTTL = time.Hour
+
+// renamePlan is the preview the athlete reviews. Applying it writes the names
+// stored here, never names sent by the browser.
+type renamePlan struct {
+	Items     []service.RenameProposal `json:"items"`
+	CreatedAt time.Time                `json:"created_at"`
+}
+
+func renamePlanKey(athleteID string) string {
+	return fmt.Sprintf("athlete/%s/rename-plan.json", athleteID)
+}
+
+// renameSelection lists the activities of the plan the request applies to
+type renameSelection struct {
+	ActivityIDs []int64 `json:"activity_ids"`
+}
+
+// handleRenamePreview serves POST /api/rename/preview?per_page=N. It proposes
+// names for the default-named activities among the athlete's latest N
+// (default 30) without renaming anything.
+func (h *WebHandler) handleRenamePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.checkCSRF(w, r) {
+		return
+	}
+
+	athleteID, err := h.currentAthlete(r)
+	if err != nil {
+		log.Printf("No valid session: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	perPage, err := intParam(r.URL.Query().Get("per_page"), defaultPerPage)
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		http.Error(w, fmt.Sprintf("per_page must be between 1 and %d", maxPerPage), http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.store.LoadTokens(r.Context(), athleteID)
+	if err != nil {
+		log.Printf("Failed to load tokens for athlete %s: %v", athleteID, err)
+		status := tokenErrorStatus(err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	client := newStravaClient(h.store, h.stravaConfig, athleteID, tokens)
+	activityService := service.NewActivityService(client)
+	activityService.SkipUndone(undoneCheck(h.store, athleteID))
+
+	activities, err := activityService.ListActivities(r.Context(), 1, perPage, 0, 0, false)
+	if err != nil {
+		log.Printf("Error listing activities for athlete %s: %v", athleteID, err)
+		if writeRateLimited(w, err) {
+			return
+		}
+		http.Error(w, "Failed to list activities", http.StatusBadGateway)
+		return
+	}
+
+	plan := renamePlan{
+		Items:     activityService.PlanRenames(r.Context(), activities),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := storage.SetTTL(r.Context(), h.store, renamePlanKey(athleteID), plan, renamePlanTTL); err != nil {
+		log.Printf("Error saving rename plan for athlete %s: %v", athleteID, err)
+		http.Error(w, "Failed to save preview", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, plan)
+}
+
+// handleRenameReroll serves POST /api/rename/reroll with a JSON body of
+// activity_ids. It proposes new names for those items of the preview.
+func (h *WebHandler) handleRenameReroll(w http.ResponseWriter, r *http.Request) {
+	athleteID, plan, selected, ok := h.loadRenamePlan(w, r)
+	if !ok {
+		return
+	}
+
+	rerolled := []service.RenameProposal{}
+	for i, item := range plan.Items {
+		if selected[item.ActivityID] {
+			plan.Items[i] = service.Reroll(item)
+			rerolled = append(rerolled, plan.Items[i])
+		}
+	}
+
+	if err := storage.SetTTL(r.Context(), h.store, renamePlanKey(athleteID), plan, renamePlanTTL); err != nil {
+		log.Printf("Error saving rename plan for athlete %s: %v", athleteID, err)
+		http.Error(w, "Failed to save preview", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"items": rerolled,
+	})
+}
+
+// handleRenameApply serves POST /api/rename/apply with a JSON body of the
+// accepted activity_ids. The other items of the preview are skipped.
+func (h *WebHandler) handleRenameApply(w http.ResponseWriter, r *http.Request) {
+	athleteID, plan, selected, ok := h.loadRenamePlan(w, r)
+	if !ok {
+		return
+	}
+
+	accepted := []service.RenameProposal{}
+	for _, item := range plan.Items {
+		if selected[item.ActivityID] {
+			accepted = append(accepted, item)
+		}
+	}
+
+	tokens, err := h.store.LoadTokens(r.Context(), athleteID)
+	if err != nil {
+		log.Printf("Failed to load tokens for athlete %s: %v", athleteID, err)
+		status := tokenErrorStatus(err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	client := newStravaClient(h.store, h.stravaConfig, athleteID, tokens)
+	activityService := service.NewActivityService(client)
+	activityService.OnRename(renameRecorder(h.store, athleteID, storage.RenameSourceManual))
+
+	report, applyErr := activityService.ApplyRenames(r.Context(), accepted)
+
+	// Applied items must not be offered again; the rest can still be
+	// applied once the rate limit resets
+	done := make(map[int64]bool, len(report.Renamed))
+	for _, item := range report.Renamed {
+		done[item.ActivityID] = true
+	}
+	remaining := []service.RenameProposal{}
+	for _, item := range plan.Items {
+		if !done[item.ActivityID] {
+			remaining = append(remaining, item)
+		}
+	}
+	if applyErr != nil {
+		plan.Items = remaining
+		err = storage.SetTTL(r.Context(), h.store, renamePlanKey(athleteID), plan, renamePlanTTL)
+	} else {
+		err = h.store.Delete(r.Context(), renamePlanKey(athleteID))
+	}
+	if err != nil {
+		log.Printf("Warning: failed to update rename plan for athlete %s: %v", athleteID, err)
+	}
+
+	if applyErr != nil {
+		log.Printf("Applying renames for athlete %s stopped: %v", athleteID, applyErr)
+	}
+
+	for _, item := range plan.Items {
+		if !selected[item.ActivityID] {
+			report.Skipped = append(report.Skipped, service.RenameOutcome{ActivityID: item.ActivityID, OldName: item.OldName, Reason: service.ReasonNotSelected})
+		}
+	}
+
+	log.Printf("Applied %d of %d proposed renames for athlete %s", len(report.Renamed), len(accepted), athleteID)
+	writeRenameReport(w, report, applyErr)
+}
+
+// writeRenameReport answers with the counts and per-activity results of a
+// rename. When renaming stopped early the report covers what was done, with
+// 429 and Retry-After if Strava's rate limit was reached.
+func writeRenameReport(w http.ResponseWriter, report *service.RenameReport, err error) {
+	status := http.StatusOK
+	var limited *strava.RateLimitError
+	if errors.As(err, &limited) {
+		setRetryAfter(w, limited)
+		status = http.StatusTooManyRequests
+	} else if err != nil {
+		status = http.StatusBadGateway
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": err == nil,
+		"renamed": len(report.Renamed),
+		"skipped": len(report.Skipped),
+		"failed":  len(report.Failed),
+		"results": report,
+	})
+}
+
+// loadRenamePlan does the checks shared by reroll and apply and returns the
+// athlete's unexpired plan with the selected activity IDs. It writes the
+// error response and returns false on failure.
+func (h *WebHandler) loadRenamePlan(w http.ResponseWriter, r *http.Request) (string, *renamePlan, map[int64]bool, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", nil, nil, false
+	}
+
+	if !h.checkCSRF(w, r) {
+		return "", nil, nil, false
+	}
+
+	athleteID, err := h.currentAthlete(r)
+	if err != nil {
+		log.Printf("No valid session: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", nil, nil, false
+	}
+
+	var selection renameSelection
+	if err := json.NewDecoder(r.Body).Decode(&selection); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return "", nil, nil, false
+	}
+
+	var plan renamePlan
+	if err := h.store.Load(r.Context(), renamePlanKey(athleteID), &plan); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "No preview to apply, request a new one", http.StatusNotFound)
+			return "", nil, nil, false
+		}
+		log.Printf("Error loading rename plan for athlete %s: %v", athleteID, err)
+		http.Error(w, "Failed to load preview", http.StatusInternalServerError)
+		return "", nil, nil, false
+	}
+	if time.Since(plan.CreatedAt) > renamePlanTTL {
+		http.Error(w, "Preview expired, request a new one", http.StatusGone)
+		return "", nil, nil, false
+	}
+
+	selected := make(map[int64]bool, len(selection.ActivityIDs))
+	for _, id := range selection.ActivityIDs {
+		selected[id] = true
+	}
+	return athleteID, &plan, selected, true
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/config"
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/guisithos/go-ride-names/internal/strava"
+)
+
+// newStravaClient creates a Strava client for the athlete that refreshes the
+// access token when needed and writes the new tokens back to the store.
+func newStravaClient(store storage.TokenStore, cfg *config.Config, athleteID string, tokens *storage.Tokens) *strava.Client {
+	persist := func(ctx context.Context, t *strava.TokenResponse) error {
+		log.Printf("Persisting refreshed tokens for athlete %s", athleteID)
+		// Strava may have rotated the refresh token, so saving it must not be
+		// abandoned when the request that triggered the refresh goes away
+		return store.SaveTokens(context.WithoutCancel(ctx), athleteID, &storage.Tokens{
+			TokenType:    t.TokenType,
+			AccessToken:  t.AccessToken,
+			RefreshToken: t.RefreshToken,
+			ExpiresAt:    t.ExpiresAt,
+		})
+	}
+
+	opts := append(StravaOptions(cfg),
+		strava.WithExpiresAt(tokens.ExpiresAt),
+		strava.WithTokenRefreshFunc(persist))
+	return strava.NewClient(tokens.AccessToken, tokens.RefreshToken,
+		cfg.StravaClientID, cfg.StravaClientSecret, opts...)
+}
+
+// StravaOptions configures a Strava client with the endpoints, HTTP client
+// and timeout from cfg
+func StravaOptions(cfg *config.Config) []strava.Option {
+	return []strava.Option{
+		strava.WithAPIURL(cfg.Strava.APIURL),
+		strava.WithOAuthURL(cfg.Strava.OAuthURL),
+		strava.WithHTTPClient(cfg.Strava.HTTPClient),
+		strava.WithTimeout(cfg.Strava.Timeout),
+	}
+}
+
+// writeRateLimited answers with 429 and a Retry-After header when err is a
+// Strava rate limit. It reports whether it wrote the response.
+func writeRateLimited(w http.ResponseWriter, err error) bool {
+	var limited *strava.RateLimitError
+	if !errors.As(err, &limited) {
+		return false
+	}
+	setRetryAfter(w, limited)
+	http.Error(w, "Strava rate limit reached, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+func setRetryAfter(w http.ResponseWriter, limited *strava.RateLimitError) {
+	seconds := int(time.Until(limited.RetryAfter).Round(time.Second).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
@@ -2,10 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
-	"os"
 	"path/filepath"
 	"time"
 
@@ -15,7 +15,6 @@ import (
 	"github.com/guisithos/go-ride-names/internal/config"
 	"github.com/guisithos/go-ride-names/internal/service"
 	"github.com/guisithos/go-ride-names/internal/storage"
-	"github.com/guisithos/go-ride-names/internal/strava"
 )
 
 type WebHandler struct {
@@ -23,14 +22,16 @@ type WebHandler struct {
 	oauthCfg     *auth.OAuth2Config
 	stravaConfig *config.Config
 	templates    *template.Template
+	sessions     *auth.SessionManager
 }
 
-func NewWebHandler(store storage.Store, oauthCfg *auth.OAuth2Config, stravaConfig *config.Config, templates *template.Template) *WebHandler {
+func NewWebHandler(store storage.Store, oauthCfg *auth.OAuth2Config, stravaConfig *config.Config, templates *template.Template, sessions *auth.SessionManager) *WebHandler {
 	return &WebHandler{
 		store:        store,
 		oauthCfg:     oauthCfg,
 		stravaConfig: stravaConfig,
 		templates:    templates,
+		sessions:     sessions,
 	}
 }
 
@@ -41,6 +42,45 @@ func (h *WebHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/subscribe", h.handleSubscribe)
 	mux.HandleFunc("/subscription-status", h.handleSubscriptionStatus)
 	mux.HandleFunc("/unsubscribe", h.handleUnsubscribe)
+	mux.HandleFunc("/api/activities", h.handleListActivities)
+	mux.HandleFunc("/api/rename/preview", h.handleRenamePreview)
+	mux.HandleFunc("/api/rename/reroll", h.handleRenameReroll)
+	mux.HandleFunc("/api/rename/apply", h.handleRenameApply)
+	mux.HandleFunc("/history", h.handleHistory)
+	mux.HandleFunc("/api/renames", h.handleListRenames)
+	mux.HandleFunc("/api/renames/undo", h.handleUndoRenames)
+	mux.HandleFunc("/logout", h.handleLogout)
+	mux.HandleFunc("/disconnect", h.handleDisconnect)
+}
+
+// currentAthlete returns the athlete ID bound to the request's verified
+// session. Every authenticated route must go through it.
+func (h *WebHandler) currentAthlete(r *http.Request) (string, error) {
+	session, err := h.sessions.Get(r)
+	if err != nil {
+		return "", err
+	}
+	return session.AthleteID, nil
+}
+
+// checkCSRF rejects state-changing requests that do not carry the session's
+// CSRF token. It writes the error response and returns false on failure.
+func (h *WebHandler) checkCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if err := h.sessions.VerifyCSRF(r); err != nil {
+		log.Printf("CSRF check failed for %s: %v", r.URL.Path, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// tokenErrorStatus maps a LoadTokens error to a response status. Missing or
+// corrupt tokens are fixed by logging in again, anything else is a server error.
+func tokenErrorStatus(err error) int {
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrCorrupt) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
 }
 
 func (h *WebHandler) handleHome(w http.ResponseWriter, r *http.Request) {
@@ -63,204 +103,148 @@ func (h *WebHandler) handleHome(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *WebHandler) handleDashboard(w http.ResponseWriter, r *http.Request) {
-	// Get session cookie
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		log.Printf("No session cookie found: %v", err)
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
-	}
-
-	// Get tokens from storage
-	athleteID := cookie.Value
-	tokensInterface, exists := h.store.GetTokens(athleteID)
-	if !exists {
-		log.Printf("No tokens found for athlete %s", athleteID)
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
-	}
+	h.renderAthletePage(w, r, "dashboard.html")
+}
 
-	// Convert stored tokens to TokenResponse
-	tokenData, err := json.Marshal(tokensInterface)
+// renderAthletePage renders a page for the logged-in athlete, sending anyone
+// else to the home page
+func (h *WebHandler) renderAthletePage(w http.ResponseWriter, r *http.Request, name string) {
+	// Get the signed session
+	session, err := h.sessions.Get(r)
 	if err != nil {
-		log.Printf("Failed to marshal token data: %v", err)
+		log.Printf("No valid session: %v", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	var tokens auth.TokenResponse
-	if err := json.Unmarshal(tokenData, &tokens); err != nil {
-		log.Printf("Failed to unmarshal token data: %v", err)
+	athleteID := session.AthleteID
+
+	// Make sure the athlete still has stored tokens
+	if _, err := h.store.LoadTokens(r.Context(), athleteID); err != nil {
+		log.Printf("Failed to load tokens for athlete %s: %v", athleteID, err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	// Render dashboard template with both athleteID and accessToken
+	// Render the template with athleteID and CSRF token
 	data := struct {
-		AthleteID   string
-		AccessToken string
+		AthleteID string
+		CSRFToken string
 	}{
-		AthleteID:   athleteID,
-		AccessToken: tokens.AccessToken,
+		AthleteID: athleteID,
+		CSRFToken: h.sessions.CSRFToken(session),
 	}
 
-	if err := h.templates.ExecuteTemplate(w, "dashboard.html", data); err != nil {
-		log.Printf("Error rendering dashboard template: %v", err)
+	if err := h.templates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("Error rendering %s template: %v", name, err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 }
 
+// handleRenameActivities serves POST /rename-activities?days=N. It renames the
+// default-named activities of the last N days (default 365).
 func (h *WebHandler) handleRenameActivities(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get athlete ID from cookie
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		log.Printf("No session cookie found: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !h.checkCSRF(w, r) {
 		return
 	}
 
-	athleteID := cookie.Value
-	tokensInterface, exists := h.store.GetTokens(athleteID)
-	if !exists {
-		log.Printf("No tokens found for athlete %s", athleteID)
+	// Get athlete ID from the signed session
+	athleteID, err := h.currentAthlete(r)
+	if err != nil {
+		log.Printf("No valid session: %v", err)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Convert the stored token data to TokenResponse
-	tokenData, err := json.Marshal(tokensInterface)
-	if err != nil {
-		log.Printf("Failed to marshal token data: %v", err)
-		http.Error(w, "Invalid token data", http.StatusInternalServerError)
+	days, err := intParam(r.URL.Query().Get("days"), defaultBackfillDays)
+	if err != nil || days < 1 || days > maxBackfillDays {
+		http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxBackfillDays), http.StatusBadRequest)
 		return
 	}
 
-	var tokens auth.TokenResponse
-	if err := json.Unmarshal(tokenData, &tokens); err != nil {
-		log.Printf("Failed to unmarshal token data: %v", err)
-		http.Error(w, "Invalid token format", http.StatusInternalServerError)
+	tokens, err := h.store.LoadTokens(r.Context(), athleteID)
+	if err != nil {
+		log.Printf("Failed to load tokens for athlete %s: %v", athleteID, err)
+		status := tokenErrorStatus(err)
+		http.Error(w, http.StatusText(status), status)
 		return
 	}
 
 	// Create Strava client and ActivityService
-	client := strava.NewClient(tokens.AccessToken, tokens.RefreshToken,
-		h.stravaConfig.StravaClientID, h.stravaConfig.StravaClientSecret)
+	client := newStravaClient(h.store, h.stravaConfig, athleteID, tokens)
 	activityService := service.NewActivityService(client)
+	activityService.OnRename(renameRecorder(h.store, athleteID, storage.RenameSourceManual))
+	activityService.SkipUndone(undoneCheck(h.store, athleteID))
 
-	// Get recent activities and update their names
-	activities, err := activityService.ListActivities(1, 30, 0, 0, true)
+	// Walk every page of the window, not just the latest activities
+	after := time.Now().AddDate(0, 0, -days).Unix()
+	report, err := activityService.RenamePages(r.Context(), activityService.Pager(0, after, service.DefaultPageSize, 1))
 	if err != nil {
-		log.Printf("Error processing activities: %v", err)
-		http.Error(w, "Failed to process activities", http.StatusInternalServerError)
-		return
+		log.Printf("Renaming activities for athlete %s stopped: %v", athleteID, err)
 	}
-
-	log.Printf("Successfully processed activities for athlete %s", athleteID)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"renamed": len(activities),
-	})
+	log.Printf("Processed activities for athlete %s: %d renamed, %d skipped, %d failed",
+		athleteID, len(report.Renamed), len(report.Skipped), len(report.Failed))
+	writeRenameReport(w, report, err)
 }
 
+// handleSubscribe turns on auto-rename for the current athlete. The Strava
+// push subscription itself is app-wide and managed by an admin.
 func (h *WebHandler) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	h.setAutoRename(w, r, true)
+}
+
+// handleUnsubscribe turns off auto-rename for the current athlete only
+func (h *WebHandler) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	h.setAutoRename(w, r, false)
+}
+
+func (h *WebHandler) setAutoRename(w http.ResponseWriter, r *http.Request, enabled bool) {
 	if r.Method != http.MethodPost {
 		log.Printf("Invalid method: %s", r.Method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get athlete ID from cookie
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		log.Printf("No session cookie found: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !h.checkCSRF(w, r) {
 		return
 	}
 
-	athleteID := cookie.Value
-	tokensInterface, exists := h.store.GetTokens(athleteID)
-	if !exists {
-		log.Printf("No tokens found for athlete %s", athleteID)
+	// Get athlete ID from the signed session
+	athleteID, err := h.currentAthlete(r)
+	if err != nil {
+		log.Printf("No valid session: %v", err)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Use token helper
-	tokens, err := auth.UnmarshalTokens(tokensInterface)
+	settings, err := loadAthleteSettings(r.Context(), h.store, athleteID)
 	if err != nil {
-		log.Printf("Token error: %v", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
+		log.Printf("Error loading settings for athlete %s: %v", athleteID, err)
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
 		return
 	}
 
-	client := strava.NewClient(tokens.AccessToken, tokens.RefreshToken,
-		h.stravaConfig.StravaClientID, h.stravaConfig.StravaClientSecret)
-	webhookService := service.NewWebhookService(client)
-
-	// Check if token needs refresh
-	now := time.Now().Unix()
-	if now >= tokens.ExpiresAt {
-		newTokens, err := client.RefreshToken()
-		if err != nil {
-			log.Printf("Failed to refresh token: %v", err)
-			http.Error(w, "Authentication error", http.StatusUnauthorized)
-			return
-		}
-
-		tokens.AccessToken = newTokens.AccessToken
-		tokens.RefreshToken = newTokens.RefreshToken
-		tokens.ExpiresAt = newTokens.ExpiresAt
-
-		if err := h.store.SetTokens(athleteID, tokens); err != nil {
-			log.Printf("Failed to update tokens: %v", err)
-			http.Error(w, "Server error", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	// Get base URL from request or environment
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://" + r.Host
-	}
-	callbackURL := baseURL + "/webhook"
-
-	// Validate Strava configuration
-	if h.stravaConfig.StravaClientID == "" || h.stravaConfig.StravaClientSecret == "" {
-		log.Printf("Error: Strava credentials not configured properly")
-		http.Error(w, "Strava configuration error", http.StatusInternalServerError)
+	settings.AutoRename = enabled
+	if err := storage.SaveAthleteSettings(r.Context(), h.store, athleteID, settings); err != nil {
+		log.Printf("Error saving settings for athlete %s: %v", athleteID, err)
+		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
 		return
 	}
 
-	verifyToken := os.Getenv("WEBHOOK_VERIFY_TOKEN")
-	if verifyToken == "" {
-		log.Printf("Error: WEBHOOK_VERIFY_TOKEN not configured")
-		http.Error(w, "Webhook verify token not configured", http.StatusInternalServerError)
-		return
+	// The settings file supersedes the legacy flag
+	if err := h.store.Delete(r.Context(), legacyWebhookActiveKey(athleteID)); err != nil {
+		log.Printf("Warning: failed to remove legacy webhook status for athlete %s: %v", athleteID, err)
 	}
 
-	err = webhookService.SubscribeToWebhooks(callbackURL, verifyToken)
-	if err != nil {
-		log.Printf("Error managing webhook subscription: %v", err)
-		http.Error(w, fmt.Sprintf("Error managing subscription: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Store subscription status in session with longer expiration
-	if err := h.store.Set(fmt.Sprintf("webhook_active:%s", athleteID), true); err != nil {
-		log.Printf("Error storing webhook status: %v", err)
-	}
-
-	log.Printf("Webhook subscription is active for athlete %s", athleteID)
+	log.Printf("Auto-rename for athlete %s: %v", athleteID, enabled)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"active": true})
+	json.NewEncoder(w).Encode(map[string]bool{"active": enabled})
 }
 
 func (h *WebHandler) handleSubscriptionStatus(w http.ResponseWriter, r *http.Request) {
@@ -269,121 +253,82 @@ func (h *WebHandler) handleSubscriptionStatus(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Get athlete ID from cookie
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		log.Printf("No session cookie found: %v", err)
-		json.NewEncoder(w).Encode(map[string]bool{"active": false})
-		return
-	}
-
-	athleteID := cookie.Value
-	tokensInterface, exists := h.store.GetTokens(athleteID)
-	if !exists {
-		log.Printf("No tokens found for athlete %s", athleteID)
-		json.NewEncoder(w).Encode(map[string]bool{"active": false})
-		return
-	}
+	w.Header().Set("Content-Type", "application/json")
 
-	// Convert stored tokens to TokenResponse
-	tokenData, err := json.Marshal(tokensInterface)
+	// Get athlete ID from the signed session
+	athleteID, err := h.currentAthlete(r)
 	if err != nil {
-		log.Printf("Failed to marshal token data: %v", err)
+		log.Printf("No valid session: %v", err)
 		json.NewEncoder(w).Encode(map[string]bool{"active": false})
 		return
 	}
 
-	var tokens auth.TokenResponse
-	if err := json.Unmarshal(tokenData, &tokens); err != nil {
-		log.Printf("Failed to unmarshal token data: %v", err)
+	settings, err := loadAthleteSettings(r.Context(), h.store, athleteID)
+	if err != nil {
+		log.Printf("Error loading settings for athlete %s: %v", athleteID, err)
 		json.NewEncoder(w).Encode(map[string]bool{"active": false})
 		return
 	}
 
-	client := strava.NewClient(tokens.AccessToken, tokens.RefreshToken,
-		h.stravaConfig.StravaClientID, h.stravaConfig.StravaClientSecret)
+	json.NewEncoder(w).Encode(map[string]bool{"active": settings.AutoRename})
+}
 
-	// Check webhook subscriptions
-	subs, err := client.ListWebhookSubscriptions()
-	if err != nil {
-		log.Printf("Error checking subscriptions: %v", err)
-		json.NewEncoder(w).Encode(map[string]bool{"active": false})
+func (h *WebHandler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Consider any subscription as active for this athlete
-	active := len(subs) > 0
-
-	// Update stored status
-	statusKey := fmt.Sprintf("webhook_active:%s", athleteID)
-	if err := h.store.Set(statusKey, active); err != nil {
-		log.Printf("Error storing webhook status: %v", err)
+	if !h.checkCSRF(w, r) {
+		return
 	}
 
-	log.Printf("Subscription status for athlete %s: Active=%v, Subs=%d",
-		athleteID, active, len(subs))
+	h.sessions.Clear(w)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"active": active})
+	json.NewEncoder(w).Encode(map[string]bool{"logged_out": true})
 }
 
-func (h *WebHandler) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+// handleDisconnect revokes the app on Strava and deletes everything we store
+// for the athlete.
+func (h *WebHandler) handleDisconnect(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		log.Printf("No session cookie found: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !h.checkCSRF(w, r) {
 		return
 	}
 
-	athleteID := cookie.Value
-	tokensInterface, exists := h.store.GetTokens(athleteID)
-	if !exists {
-		log.Printf("No tokens found for athlete %s", athleteID)
+	athleteID, err := h.currentAthlete(r)
+	if err != nil {
+		log.Printf("No valid session: %v", err)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	tokenData, err := json.Marshal(tokensInterface)
+	// Revoke on Strava first; if the tokens are already gone or invalid there
+	// is nothing left to revoke, so we still purge our copy.
+	tokens, err := h.store.LoadTokens(r.Context(), athleteID)
 	if err != nil {
-		log.Printf("Failed to marshal token data: %v", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
-
-	var tokens auth.TokenResponse
-	if err := json.Unmarshal(tokenData, &tokens); err != nil {
-		log.Printf("Failed to unmarshal token data: %v", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
+		log.Printf("Failed to load tokens for athlete %s: %v", athleteID, err)
+	} else {
+		client := newStravaClient(h.store, h.stravaConfig, athleteID, tokens)
+		if err := client.Deauthorize(r.Context()); err != nil {
+			log.Printf("Warning: failed to deauthorize athlete %s on Strava: %v", athleteID, err)
+		}
 	}
 
-	client := strava.NewClient(tokens.AccessToken, tokens.RefreshToken,
-		h.stravaConfig.StravaClientID, h.stravaConfig.StravaClientSecret)
-
-	// Force deletion of all subscriptions
-	subs, err := client.ListWebhookSubscriptions()
-	if err != nil {
-		log.Printf("Error listing subscriptions: %v", err)
-		http.Error(w, "Failed to list subscriptions", http.StatusInternalServerError)
+	if err := purgeAthlete(r.Context(), h.store, athleteID); err != nil {
+		log.Printf("Failed to delete data for athlete %s: %v", athleteID, err)
+		http.Error(w, "Failed to delete data", http.StatusInternalServerError)
 		return
 	}
 
-	for _, sub := range subs {
-		log.Printf("Attempting to delete subscription ID: %d with URL: %s", sub.ID, sub.CallbackURL)
-		if err := client.DeleteWebhookSubscription(sub.ID); err != nil {
-			log.Printf("Warning: failed to delete subscription %d: %v", sub.ID, err)
-		}
-	}
-
-	// Remove subscription status from store
-	statusKey := fmt.Sprintf("webhook_active:%s", athleteID)
-	h.store.Set(statusKey, nil)
+	h.sessions.Clear(w)
+	log.Printf("Athlete %s disconnected", athleteID)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"active": false})
+	json.NewEncoder(w).Encode(map[string]bool{"disconnected": true})
 }
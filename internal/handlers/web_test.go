@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/auth"
+	"github.com/guisithos/go-ride-names/internal/config"
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
+// newSessionRequest builds a request authenticated as athleteID, carrying the
+// session's CSRF token
+func newSessionRequest(t *testing.T, sessions *auth.SessionManager, athleteID, method, path string) *http.Request {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	session, err := sessions.Issue(rec, athleteID)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(method, path, nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	req.Header.Set(auth.CSRFHeader, sessions.CSRFToken(session))
+	return req
+}
+
+func TestWebHandler_AutoRenameIsPerAthlete(t *testing.T) {
+	store := storage.NewMemoryStore()
+	sessions := auth.NewSessionManager(testSessionSecret, time.Hour)
+	mux := http.NewServeMux()
+	NewWebHandler(store, nil, &config.Config{}, nil, sessions).RegisterRoutes(mux)
+
+	status := func(athleteID string) bool {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newSessionRequest(t, sessions, athleteID, http.MethodGet, "/subscription-status"))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var body map[string]bool
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		return body["active"]
+	}
+
+	for _, athleteID := range []string{"1", "2"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newSessionRequest(t, sessions, athleteID, http.MethodPost, "/subscribe"))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, newSessionRequest(t, sessions, "1", http.MethodPost, "/unsubscribe"))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	assert.False(t, status("1"))
+	assert.True(t, status("2"))
+}
+
+func TestLoadAthleteSettings_LegacyFlag(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.Set(ctx, legacyWebhookActiveKey("5"), true))
+
+	settings, err := loadAthleteSettings(ctx, store, "5")
+	require.NoError(t, err)
+	assert.True(t, settings.AutoRename)
+
+	settings, err = loadAthleteSettings(ctx, store, "6")
+	require.NoError(t, err)
+	assert.False(t, settings.AutoRename)
+}
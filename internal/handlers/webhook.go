@@ -2,51 +2,135 @@ package handlers
 
 import (
 	"bytes"
-	"crypto/rand"
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"time"
 
-	"github.com/guisithos/go-ride-names/internal/auth"
 	"github.com/guisithos/go-ride-names/internal/config"
+	"github.com/guisithos/go-ride-names/internal/queue"
 	"github.com/guisithos/go-ride-names/internal/service"
 	"github.com/guisithos/go-ride-names/internal/storage"
 	"github.com/guisithos/go-ride-names/internal/strava"
 )
 
 type WebhookEvent struct {
-	ObjectType string                 `json:"object_type"`
-	ObjectID   int64                  `json:"object_id"`
-	AspectType string                 `json:"aspect_type"`
-	OwnerID    int64                  `json:"owner_id"`
-	Updates    map[string]interface{} `json:"updates"`
+	ObjectType     string                 `json:"object_type"`
+	ObjectID       int64                  `json:"object_id"`
+	AspectType     string                 `json:"aspect_type"`
+	OwnerID        int64                  `json:"owner_id"`
+	SubscriptionID int64                  `json:"subscription_id"`
+	EventTime      int64                  `json:"event_time"`
+	Updates        map[string]interface{} `json:"updates"`
+}
+
+// IsDeauthorization reports whether the event is Strava telling us the athlete
+// revoked access to the app.
+func (e WebhookEvent) IsDeauthorization() bool {
+	if e.ObjectType != "athlete" {
+		return false
+	}
+	switch v := e.Updates["authorized"].(type) {
+	case string:
+		return v == "false"
+	case bool:
+		return !v
+	}
+	return false
+}
+
+// DeauthorizationRecord is stored for every athlete deauthorization event
+type DeauthorizationRecord struct {
+	AthleteID  int64     `json:"athlete_id"`
+	EventTime  int64     `json:"event_time"`
+	ReceivedAt time.Time `json:"received_at"`
+	Purged     bool      `json:"purged"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// webhookLedgerTTL is how long an accepted event is remembered; Strava only
+// redelivers events for a short while after the first attempt. Stores without
+// expiry, such as GCS, keep entries until sweepWebhookLedger removes them.
+const webhookLedgerTTL = 7 * 24 * time.Hour
+
+// webhookLedgerEntry records that an event was accepted, so that redeliveries
+// of the same event are acknowledged without being processed again
+type webhookLedgerEntry struct {
+	Event      WebhookEvent `json:"event"`
+	ReceivedAt time.Time    `json:"received_at"`
+}
+
+// renamedMarker is stored once we have renamed an activity
+type renamedMarker struct {
+	ActivityID int64     `json:"activity_id"`
+	RenamedAt  time.Time `json:"renamed_at"`
+}
+
+// Both keys live under the athlete's prefix so they go away with the athlete
+func webhookLedgerKey(event WebhookEvent) string {
+	return fmt.Sprintf("%s%s-%d-%s.json",
+		webhookLedgerPrefix(event.OwnerID), event.ObjectType, event.ObjectID, event.AspectType)
+}
+
+func webhookLedgerPrefix(ownerID int64) string {
+	return fmt.Sprintf("athlete/%d/webhook-events/", ownerID)
+}
+
+func renamedMarkerKey(ownerID string, activityID int64) string {
+	return fmt.Sprintf("athlete/%s/renamed/%d.json", ownerID, activityID)
+}
+
+// SubscriptionSource tells which push subscription the app has with Strava.
+// It is satisfied by service.WebhookService.
+type SubscriptionSource interface {
+	LastStatus() *service.SubscriptionStatus
+	Refresh(ctx context.Context) (*service.SubscriptionStatus, error)
 }
 
 type WebhookHandler struct {
-	store        storage.Store
-	stravaConfig *config.Config
-	verifyToken  string
+	store         storage.Store
+	stravaConfig  *config.Config
+	verifyToken   string
+	queue         queue.Queue
+	subscriptions SubscriptionSource
 }
 
-func NewWebhookHandler(store storage.Store, stravaConfig *config.Config) *WebhookHandler {
-	verifyToken := os.Getenv("WEBHOOK_VERIFY_TOKEN")
-	if verifyToken == "" {
-		log.Println("Warning: WEBHOOK_VERIFY_TOKEN not set")
-		// Generate a random token as fallback
-		token := make([]byte, 32)
-		rand.Read(token)
-		verifyToken = hex.EncodeToString(token)
+func NewWebhookHandler(store storage.Store, stravaConfig *config.Config, events queue.Queue, subscriptions SubscriptionSource) *WebhookHandler {
+	return &WebhookHandler{
+		store:         store,
+		stravaConfig:  stravaConfig,
+		verifyToken:   stravaConfig.Webhook.VerifyToken,
+		queue:         events,
+		subscriptions: subscriptions,
 	}
+}
 
-	return &WebhookHandler{
-		store:        store,
-		stravaConfig: stravaConfig,
-		verifyToken:  verifyToken,
+// fromSubscription reports whether the event was sent for the app's own push
+// subscription. The endpoint is unauthenticated, so anything else is forged
+// or left over from a replaced subscription. The subscription we know of may
+// be stale, e.g. replaced by another instance, so an unknown ID is checked
+// against Strava before the event is refused.
+func (h *WebhookHandler) fromSubscription(ctx context.Context, event WebhookEvent) bool {
+	if event.SubscriptionID == 0 {
+		return false
+	}
+	if matchesSubscription(h.subscriptions.LastStatus(), event) {
+		return true
 	}
+	status, err := h.subscriptions.Refresh(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to refresh webhook subscription: %v", err)
+		return false
+	}
+	return matchesSubscription(status, event)
+}
+
+func matchesSubscription(status *service.SubscriptionStatus, event WebhookEvent) bool {
+	return status != nil && status.Subscription != nil && status.Subscription.ID == event.SubscriptionID
 }
 
 func (h *WebhookHandler) RegisterRoutes(mux *http.ServeMux) {
@@ -67,8 +151,8 @@ func (h *WebhookHandler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Webhook verification - Challenge: %s, Token: %s, Expected Token: %s",
 			challenge, verifyToken, h.verifyToken)
 
-		// First verify the token
-		if verifyToken != h.verifyToken {
+		// First verify the token; without one configured nothing can match
+		if h.verifyToken == "" || verifyToken != h.verifyToken {
 			log.Printf("Invalid verify_token received: %s, expected: %s",
 				verifyToken, h.verifyToken)
 			http.Error(w, "Invalid verification token", http.StatusBadRequest)
@@ -107,21 +191,57 @@ func (h *WebhookHandler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Log the decoded event
-		log.Printf("Processing webhook event: Type=%s, ID=%d, AspectType=%s, OwnerID=%d",
-			event.ObjectType, event.ObjectID, event.AspectType, event.OwnerID)
-
-		if event.ObjectType == "activity" && event.AspectType == "create" {
-			if err := h.processActivityWebhook(event); err != nil {
-				log.Printf("Error processing webhook: %v", err)
-				http.Error(w, "Error processing webhook", http.StatusInternalServerError)
-				return
-			}
-			log.Printf("Successfully processed webhook for activity %d", event.ObjectID)
-		} else {
+		log.Printf("Processing webhook event: Type=%s, ID=%d, AspectType=%s, OwnerID=%d, SubscriptionID=%d",
+			event.ObjectType, event.ObjectID, event.AspectType, event.OwnerID, event.SubscriptionID)
+
+		if !h.fromSubscription(r.Context(), event) {
+			log.Printf("Rejecting webhook event for unknown subscription %d", event.SubscriptionID)
+			http.Error(w, "Unknown subscription", http.StatusForbidden)
+			return
+		}
+
+		if !event.IsDeauthorization() && !(event.ObjectType == "activity" && event.AspectType == "create") {
 			log.Printf("Skipping event: not a new activity (Type=%s, Aspect=%s)",
 				event.ObjectType, event.AspectType)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		// Strava may deliver the same event more than once. Expired entries
+		// go first so they are not taken for one.
+		h.sweepWebhookLedger(r.Context(), event.OwnerID)
+		ledgerKey := webhookLedgerKey(event)
+		created, err := storage.CreateTTL(r.Context(), h.store, ledgerKey, webhookLedgerEntry{
+			Event:      event,
+			ReceivedAt: time.Now().UTC(),
+		}, webhookLedgerTTL)
+		if err != nil {
+			log.Printf("Error recording webhook event: %v", err)
+			http.Error(w, "Error processing webhook", http.StatusInternalServerError)
+			return
+		}
+		if !created {
+			log.Printf("Skipping duplicate webhook event: Type=%s, ID=%d, AspectType=%s, OwnerID=%d",
+				event.ObjectType, event.ObjectID, event.AspectType, event.OwnerID)
+			w.WriteHeader(http.StatusOK)
+			return
 		}
 
+		// Strava expects an answer within 2 seconds, so the work happens in
+		// the queue workers. Only a failure to persist the event is reported,
+		// which makes Strava redeliver it.
+		job, err := h.queue.Enqueue(r.Context(), event)
+		if err != nil {
+			log.Printf("Error enqueueing webhook event: %v", err)
+			// Forget the event so the redelivery is not taken for a duplicate
+			if err := h.store.Delete(r.Context(), ledgerKey); err != nil {
+				log.Printf("Warning: failed to remove webhook ledger entry %s: %v", ledgerKey, err)
+			}
+			http.Error(w, "Error processing webhook", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Enqueued webhook event as job %s", job.ID)
+
 		w.WriteHeader(http.StatusOK)
 		return
 
@@ -130,34 +250,202 @@ func (h *WebhookHandler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *WebhookHandler) processActivityWebhook(event WebhookEvent) error {
+// sweepWebhookLedger deletes the athlete's ledger entries older than
+// webhookLedgerTTL, which stores without expiry would keep forever. It runs
+// before each event is recorded, so the ledger stays bounded by the events of
+// the last week. Failures only delay the cleanup and are logged.
+func (h *WebhookHandler) sweepWebhookLedger(ctx context.Context, ownerID int64) {
+	keys, err := h.store.List(ctx, webhookLedgerPrefix(ownerID))
+	if err != nil {
+		log.Printf("Warning: failed to list webhook ledger of athlete %d: %v", ownerID, err)
+		return
+	}
+
+	cutoff := time.Now().Add(-webhookLedgerTTL)
+	for _, key := range keys {
+		var entry webhookLedgerEntry
+		if err := h.store.Load(ctx, key, &entry); err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				log.Printf("Warning: failed to load webhook ledger entry %s: %v", key, err)
+			}
+			continue
+		}
+		if entry.ReceivedAt.Before(cutoff) {
+			if err := h.store.Delete(ctx, key); err != nil {
+				log.Printf("Warning: failed to delete webhook ledger entry %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// ProcessJob handles a webhook event taken from the queue. Errors are retried
+// by the worker unless marked permanent.
+func (h *WebhookHandler) ProcessJob(ctx context.Context, job *queue.Job) error {
+	var event WebhookEvent
+	if err := job.Decode(&event); err != nil {
+		return queue.Permanent(fmt.Errorf("invalid webhook event in job %s: %v", job.ID, err))
+	}
+
+	if event.IsDeauthorization() {
+		if err := h.processDeauthorization(ctx, event); err != nil {
+			return err
+		}
+		log.Printf("Processed deauthorization for athlete %d", event.OwnerID)
+		return nil
+	}
+
+	if err := h.processActivityWebhook(ctx, event); err != nil {
+		return stravaJobError(err)
+	}
+	log.Printf("Successfully processed webhook for activity %d", event.ObjectID)
+	return nil
+}
+
+// stravaJobError tells the worker how to retry a job that failed talking to
+// Strava
+func stravaJobError(err error) error {
+	// Wait for the rate-limit window to reset instead of burning attempts
+	var limited *strava.RateLimitError
+	if errors.As(err, &limited) {
+		return queue.RetryAt(err, limited.RetryAfter)
+	}
+	// Client errors, such as a deleted activity, fail the same way again
+	var apiErr *strava.APIError
+	if errors.As(err, &apiErr) && !apiErr.Retryable() {
+		return queue.Permanent(err)
+	}
+	return err
+}
+
+func (h *WebhookHandler) processActivityWebhook(ctx context.Context, event WebhookEvent) error {
 	log.Printf("Starting to process activity webhook for ID=%d", event.ObjectID)
 
 	ownerID := fmt.Sprintf("%d", event.OwnerID)
-	tokensInterface, exists := h.store.GetTokens(ownerID)
-	if !exists {
-		return fmt.Errorf("no tokens found for athlete %s", ownerID)
+	tokens, err := h.store.LoadTokens(ctx, ownerID)
+	if err != nil {
+		err = fmt.Errorf("failed to load tokens for athlete %s: %w", ownerID, err)
+		// Retrying will not make tokens appear for an athlete we don't know
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrCorrupt) {
+			return queue.Permanent(err)
+		}
+		return err
 	}
 
-	tokenData, err := json.Marshal(tokensInterface)
+	// The subscription is app-wide, so every athlete's events arrive here
+	settings, err := loadAthleteSettings(ctx, h.store, ownerID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal token data: %v", err)
+		return fmt.Errorf("failed to load settings for athlete %s: %v", ownerID, err)
+	}
+	if !settings.AutoRename {
+		log.Printf("Auto-rename is off for athlete %s, skipping activity %d", ownerID, event.ObjectID)
+		return nil
 	}
 
-	var tokens auth.TokenResponse
-	if err := json.Unmarshal(tokenData, &tokens); err != nil {
-		return fmt.Errorf("failed to unmarshal token data: %v", err)
+	// A retried job may find the activity already renamed by an earlier attempt
+	markerKey := renamedMarkerKey(ownerID, event.ObjectID)
+	var marker renamedMarker
+	err = h.store.Load(ctx, markerKey, &marker)
+	if err == nil {
+		log.Printf("Activity %d was already renamed at %s, skipping", event.ObjectID, marker.RenamedAt)
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to check rename marker for activity %d: %v", event.ObjectID, err)
 	}
 
-	client := strava.NewClient(tokens.AccessToken, tokens.RefreshToken,
-		h.stravaConfig.StravaClientID, h.stravaConfig.StravaClientSecret)
+	client := newStravaClient(h.store, h.stravaConfig, ownerID, tokens)
 	activityService := service.NewActivityService(client)
+	activityService.OnRename(renameRecorder(h.store, ownerID, storage.RenameSourceWebhook))
+	activityService.SkipUndone(undoneCheck(h.store, ownerID))
 
 	log.Printf("Attempting to rename activity %d", event.ObjectID)
-	if err := activityService.RenameActivity(event.ObjectID); err != nil {
-		return fmt.Errorf("failed to rename activity: %v", err)
+	renamed, err := activityService.RenameActivity(ctx, event.ObjectID)
+	if err != nil {
+		return fmt.Errorf("failed to rename activity: %w", err)
+	}
+	if !renamed {
+		return nil
+	}
+
+	marker = renamedMarker{ActivityID: event.ObjectID, RenamedAt: time.Now().UTC()}
+	if err := h.store.Set(ctx, markerKey, marker); err != nil {
+		// The activity no longer has a default name, so a retry would skip it anyway
+		log.Printf("Warning: failed to record rename of activity %d: %v", event.ObjectID, err)
 	}
 
 	log.Printf("Successfully renamed activity %d", event.ObjectID)
 	return nil
 }
+
+// processDeauthorization purges everything stored for an athlete who revoked
+// access on strava.com and records the event. Nothing is purged unless
+// Strava confirms the stored tokens no longer work.
+func (h *WebhookHandler) processDeauthorization(ctx context.Context, event WebhookEvent) error {
+	ownerID := fmt.Sprintf("%d", event.OwnerID)
+
+	revoked, err := h.accessRevoked(ctx, ownerID)
+	if err != nil {
+		return stravaJobError(fmt.Errorf("failed to confirm deauthorization of athlete %s: %w", ownerID, err))
+	}
+	if !revoked {
+		log.Printf("Ignoring deauthorization of athlete %s: Strava still accepts the stored tokens", ownerID)
+		// Forget the event so a real deauthorization is not taken for a duplicate
+		if err := h.store.Delete(ctx, webhookLedgerKey(event)); err != nil {
+			log.Printf("Warning: failed to remove webhook ledger entry for athlete %s: %v", ownerID, err)
+		}
+		return nil
+	}
+	log.Printf("Athlete %s deauthorized the app, purging data", ownerID)
+
+	record := DeauthorizationRecord{
+		AthleteID:  event.OwnerID,
+		EventTime:  event.EventTime,
+		ReceivedAt: time.Now().UTC(),
+	}
+
+	purgeErr := purgeAthlete(ctx, h.store, ownerID)
+	if purgeErr != nil {
+		record.Error = purgeErr.Error()
+	} else {
+		record.Purged = true
+	}
+
+	// Recorded outside athlete/<id>/ so the purge does not remove it
+	key := fmt.Sprintf("deauthorizations/%s/%d.json", ownerID, record.ReceivedAt.UnixNano())
+	if err := h.store.Set(ctx, key, record); err != nil {
+		log.Printf("Warning: failed to record deauthorization for athlete %s: %v", ownerID, err)
+	}
+
+	if purgeErr != nil {
+		return fmt.Errorf("failed to purge athlete %s: %v", ownerID, purgeErr)
+	}
+	return nil
+}
+
+// accessRevoked asks Strava whether the athlete's stored tokens still work.
+// A refused access token that cannot be refreshed means access was revoked.
+func (h *WebhookHandler) accessRevoked(ctx context.Context, athleteID string) (bool, error) {
+	tokens, err := h.store.LoadTokens(ctx, athleteID)
+	if err != nil {
+		// Without usable tokens there is nothing left to revoke, e.g. when
+		// an earlier attempt deleted them before the purge failed
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrCorrupt) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	client := newStravaClient(h.store, h.stravaConfig, athleteID, tokens)
+	_, err = client.GetAuthenticatedAthlete(ctx)
+	if err == nil {
+		return false, nil
+	}
+	var apiErr *strava.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+			return true, nil
+		}
+	}
+	return false, err
+}
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/config"
+	"github.com/guisithos/go-ride-names/internal/queue"
+	"github.com/guisithos/go-ride-names/internal/service"
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/guisithos/go-ride-names/internal/strava"
+	"github.com/guisithos/go-ride-names/internal/strava/stravatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookEvent_IsDeauthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    WebhookEvent
+		expected bool
+	}{
+		{
+			name:     "string false",
+			event:    WebhookEvent{ObjectType: "athlete", Updates: map[string]interface{}{"authorized": "false"}},
+			expected: true,
+		},
+		{
+			name:     "bool false",
+			event:    WebhookEvent{ObjectType: "athlete", Updates: map[string]interface{}{"authorized": false}},
+			expected: true,
+		},
+		{
+			name:     "athlete update",
+			event:    WebhookEvent{ObjectType: "athlete", Updates: map[string]interface{}{"title": "x"}},
+			expected: false,
+		},
+		{
+			name:     "activity event",
+			event:    WebhookEvent{ObjectType: "activity", Updates: map[string]interface{}{"authorized": "false"}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.event.IsDeauthorization())
+		})
+	}
+}
+
+// testSubscription is the push subscription the tests' events are sent for
+var testSubscription = fixedSubscription(1)
+
+type fixedSubscription int64
+
+func (id fixedSubscription) LastStatus() *service.SubscriptionStatus {
+	return &service.SubscriptionStatus{Subscription: &strava.WebhookSubscription{ID: int64(id)}}
+}
+
+func (id fixedSubscription) Refresh(ctx context.Context) (*service.SubscriptionStatus, error) {
+	return id.LastStatus(), nil
+}
+
+// stravaAnswering is a Strava API and OAuth server that answers every
+// request with status
+func stravaAnswering(t *testing.T, status int) *config.Config {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"id": 99}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{}
+	cfg.Strava.APIURL = server.URL
+	cfg.Strava.OAuthURL = server.URL
+	return cfg
+}
+
+func TestWebhookHandler_Deauthorization(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.SaveTokens(ctx, "99", &storage.Tokens{AccessToken: "a", RefreshToken: "r"}))
+	require.NoError(t, store.Set(ctx, "athlete/99/settings.json", map[string]bool{"auto_rename": true}))
+
+	// Strava refuses the revoked tokens
+	events := queue.NewStoreQueue(store, "webhook")
+	handler := NewWebhookHandler(store, stravaAnswering(t, http.StatusUnauthorized), events, testSubscription)
+	mux := http.NewServeMux()
+	handler.RegisterRoutes(mux)
+
+	body := `{"aspect_type":"update","event_time":1516126040,"object_id":99,"object_type":"athlete","owner_id":99,"subscription_id":1,"updates":{"authorized":"false"}}`
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Nothing happens until the queued event is processed
+	_, err := store.LoadTokens(ctx, "99")
+	require.NoError(t, err)
+
+	n, err := queue.NewWorker(events, handler.ProcessJob, queue.WorkerOptions{}).ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = store.LoadTokens(ctx, "99")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	keys, err := store.List(ctx, "athlete/99/")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	records, err := store.List(ctx, "deauthorizations/99/")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	var record DeauthorizationRecord
+	require.NoError(t, store.Load(ctx, records[0], &record))
+	assert.True(t, record.Purged)
+	assert.Equal(t, int64(1516126040), record.EventTime)
+}
+
+func TestWebhookHandler_DeauthorizationNeedsRevokedTokens(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.SaveTokens(ctx, "99", &storage.Tokens{AccessToken: "a", RefreshToken: "r"}))
+
+	// Strava still accepts the tokens, so the athlete did not revoke access
+	handler := NewWebhookHandler(store, stravaAnswering(t, http.StatusOK), queue.NewStoreQueue(store, "webhook"), testSubscription)
+	job := &queue.Job{Payload: []byte(`{"aspect_type":"update","object_id":99,"object_type":"athlete","owner_id":99,"subscription_id":1,"updates":{"authorized":"false"}}`)}
+	require.NoError(t, handler.ProcessJob(ctx, job))
+
+	_, err := store.LoadTokens(ctx, "99")
+	assert.NoError(t, err)
+	records, err := store.List(ctx, "deauthorizations/99/")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestWebhookHandler_RejectsForgedSubscription(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.SaveTokens(ctx, "99", &storage.Tokens{AccessToken: "a", RefreshToken: "r"}))
+	require.NoError(t, storage.SaveAthleteSettings(ctx, store, "99", &storage.AthleteSettings{AutoRename: true}))
+
+	events := queue.NewStoreQueue(store, "webhook")
+	handler := NewWebhookHandler(store, stravaAnswering(t, http.StatusUnauthorized), events, testSubscription)
+	mux := http.NewServeMux()
+	handler.RegisterRoutes(mux)
+
+	for name, body := range map[string]string{
+		"wrong subscription": `{"aspect_type":"update","object_id":99,"object_type":"athlete","owner_id":99,"subscription_id":2,"updates":{"authorized":"false"}}`,
+		"no subscription":    `{"aspect_type":"update","object_id":99,"object_type":"athlete","owner_id":99,"updates":{"authorized":"false"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		})
+	}
+
+	n, err := queue.NewWorker(events, handler.ProcessJob, queue.WorkerOptions{}).ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = store.LoadTokens(ctx, "99")
+	assert.NoError(t, err)
+	keys, err := store.List(ctx, "athlete/99/")
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+}
+
+// Before reconciliation the subscription is looked up on Strava, and events
+// are refused while the app has none
+func TestWebhookHandler_RejectsEventsWithoutSubscription(t *testing.T) {
+	fake := stravatest.NewServer()
+	defer fake.Close()
+	cfg := &config.Config{StravaClientID: stravatest.ClientID, StravaClientSecret: stravatest.ClientSecret}
+	cfg.Strava.APIURL = fake.APIURL()
+	cfg.Strava.OAuthURL = fake.OAuthURL()
+	client := strava.NewClient("", "", cfg.StravaClientID, cfg.StravaClientSecret, StravaOptions(cfg)...)
+
+	store := storage.NewMemoryStore()
+	events := queue.NewStoreQueue(store, "webhook")
+	mux := http.NewServeMux()
+	NewWebhookHandler(store, cfg, events, service.NewWebhookService(client, "https://example.com/webhook", "verify")).RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	body := `{"aspect_type":"create","object_id":1,"object_type":"activity","owner_id":7,"subscription_id":1}`
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, 1, fake.Requests(http.MethodGet, "/api/v3/push_subscriptions"))
+}
+
+func TestWebhookHandler_EnqueuesAndAcknowledges(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	events := queue.NewStoreQueue(store, "webhook")
+	mux := http.NewServeMux()
+	NewWebhookHandler(store, &config.Config{}, events, testSubscription).RegisterRoutes(mux)
+
+	tests := []struct {
+		name     string
+		body     string
+		enqueued bool
+	}{
+		{
+			name:     "new activity",
+			body:     `{"aspect_type":"create","object_id":1,"object_type":"activity","owner_id":7,"subscription_id":1}`,
+			enqueued: true,
+		},
+		{
+			name:     "activity update",
+			body:     `{"aspect_type":"update","object_id":1,"object_type":"activity","owner_id":7,"subscription_id":1,"updates":{"title":"x"}}`,
+			enqueued: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			jobs, err := events.Claim(ctx, time.Now(), 10, time.Minute)
+			require.NoError(t, err)
+			if tt.enqueued {
+				assert.Len(t, jobs, 1)
+			} else {
+				assert.Empty(t, jobs)
+			}
+			for _, job := range jobs {
+				events.Complete(ctx, job)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_UnknownAthleteIsPermanent(t *testing.T) {
+	store := storage.NewMemoryStore()
+	handler := NewWebhookHandler(store, &config.Config{}, queue.NewStoreQueue(store, "webhook"), testSubscription)
+
+	job := &queue.Job{Payload: []byte(`{"aspect_type":"create","object_id":1,"object_type":"activity","owner_id":7}`)}
+	err := handler.ProcessJob(context.Background(), job)
+	assert.True(t, queue.IsPermanent(err))
+}
+
+func TestWebhookHandler_DuplicateDeliveryIsEnqueuedOnce(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	events := queue.NewStoreQueue(store, "webhook")
+	mux := http.NewServeMux()
+	NewWebhookHandler(store, &config.Config{}, events, testSubscription).RegisterRoutes(mux)
+
+	body := `{"aspect_type":"create","object_id":1,"object_type":"activity","owner_id":7,"subscription_id":1}`
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	jobs, err := events.Claim(ctx, time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
+
+// Stores without expiry drop ledger entries past the TTL as new events come
+// in, and an expired entry does not make its event a duplicate
+func TestWebhookHandler_SweepsExpiredLedgerEntries(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	events := queue.NewStoreQueue(store, "webhook")
+	mux := http.NewServeMux()
+	NewWebhookHandler(store, &config.Config{}, events, testSubscription).RegisterRoutes(mux)
+
+	expired := WebhookEvent{ObjectType: "activity", ObjectID: 1, AspectType: "create", OwnerID: 7, SubscriptionID: 1}
+	old := WebhookEvent{ObjectType: "activity", ObjectID: 2, AspectType: "create", OwnerID: 7, SubscriptionID: 1}
+	recent := WebhookEvent{ObjectType: "activity", ObjectID: 3, AspectType: "create", OwnerID: 7, SubscriptionID: 1}
+	longAgo := time.Now().Add(-webhookLedgerTTL - time.Hour)
+	require.NoError(t, store.Set(ctx, webhookLedgerKey(expired), webhookLedgerEntry{Event: expired, ReceivedAt: longAgo}))
+	require.NoError(t, store.Set(ctx, webhookLedgerKey(old), webhookLedgerEntry{Event: old, ReceivedAt: longAgo}))
+	require.NoError(t, store.Set(ctx, webhookLedgerKey(recent), webhookLedgerEntry{Event: recent, ReceivedAt: time.Now()}))
+
+	body := `{"aspect_type":"create","object_id":1,"object_type":"activity","owner_id":7,"subscription_id":1}`
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	jobs, err := events.Claim(ctx, time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	keys, err := store.List(ctx, webhookLedgerPrefix(7))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{webhookLedgerKey(expired), webhookLedgerKey(recent)}, keys)
+}
+
+func TestWebhookHandler_SkipsActivityAlreadyRenamed(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.SaveTokens(ctx, "7", &storage.Tokens{AccessToken: "a", RefreshToken: "r"}))
+	require.NoError(t, storage.SaveAthleteSettings(ctx, store, "7", &storage.AthleteSettings{AutoRename: true}))
+	require.NoError(t, store.Set(ctx, renamedMarkerKey("7", 1), renamedMarker{ActivityID: 1, RenamedAt: time.Now()}))
+
+	handler := NewWebhookHandler(store, &config.Config{}, queue.NewStoreQueue(store, "webhook"), testSubscription)
+
+	// Strava is never contacted, otherwise this would fail on the fake tokens
+	job := &queue.Job{Payload: []byte(`{"aspect_type":"create","object_id":1,"object_type":"activity","owner_id":7}`)}
+	assert.NoError(t, handler.ProcessJob(ctx, job))
+}
+
+func TestWebhookHandler_SkipsAthletesWithoutAutoRename(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.SaveTokens(ctx, "7", &storage.Tokens{AccessToken: "a", RefreshToken: "r"}))
+	require.NoError(t, storage.SaveAthleteSettings(ctx, store, "7", &storage.AthleteSettings{AutoRename: false}))
+
+	handler := NewWebhookHandler(store, &config.Config{}, queue.NewStoreQueue(store, "webhook"), testSubscription)
+
+	job := &queue.Job{Payload: []byte(`{"aspect_type":"create","object_id":1,"object_type":"activity","owner_id":7}`)}
+	assert.NoError(t, handler.ProcessJob(ctx, job))
+}
+
+func TestWebhookHandler_VerificationRequiresConfiguredToken(t *testing.T) {
+	store := storage.NewMemoryStore()
+
+	tests := []struct {
+		name       string
+		configured string
+		sent       string
+		expected   int
+	}{
+		{name: "matching token", configured: "secret", sent: "secret", expected: http.StatusOK},
+		{name: "wrong token", configured: "secret", sent: "other", expected: http.StatusBadRequest},
+		{name: "no token configured", configured: "", sent: "", expected: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Webhook.VerifyToken = tt.configured
+			mux := http.NewServeMux()
+			NewWebhookHandler(store, cfg, queue.NewStoreQueue(store, "webhook"), testSubscription).RegisterRoutes(mux)
+
+			rec := httptest.NewRecorder()
+			url := "/webhook?hub.mode=subscribe&hub.challenge=abc&hub.verify_token=" + tt.sent
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+			assert.Equal(t, tt.expected, rec.Code)
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"runtime"
+	"strings"
 	"time"
 )
 
@@ -22,23 +24,31 @@ type CheckStatus struct {
 	Message string `json:"message,omitempty"`
 }
 
+// HealthCheck reports the status of one dependency or background task
+type HealthCheck func() CheckStatus
+
 type SystemInfo struct {
 	NumGoroutines int    `json:"num_goroutines"`
 	NumCPU        int    `json:"num_cpu"`
 	HeapInUse     uint64 `json:"heap_in_use"`
 }
 
-// Health middleware checks
-func Health(version, env string) Middleware {
+// Health middleware checks. Strava is probed at stravaAPIURL; extra checks
+// are reported under their name next to the built-in ones.
+func Health(version, env, stravaAPIURL string, extra map[string]HealthCheck) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.URL.Path == "/health" {
-				checks := performHealthChecks()
+				checks := performHealthChecks(r.Context(), stravaAPIURL)
+				for name, check := range extra {
+					checks[name] = check()
+				}
 				status := "ok"
 
-				// If any check failed, mark as error
+				// If any check failed, mark as error. Other statuses, such as
+				// "disabled", are informational.
 				for _, check := range checks {
-					if check.Status != "ok" {
+					if check.Status == "error" {
 						status = "error"
 						break
 					}
@@ -73,11 +83,22 @@ func Health(version, env string) Middleware {
 	}
 }
 
-func performHealthChecks() map[string]CheckStatus {
+// healthCheckTimeout bounds the outbound checks so /health never hangs
+const healthCheckTimeout = 5 * time.Second
+
+func performHealthChecks(ctx context.Context, stravaAPIURL string) map[string]CheckStatus {
 	checks := make(map[string]CheckStatus)
 
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
 	// Check Strava API health by attempting to make a request
-	stravaResp, err := http.Get("https://www.strava.com/api/v3/athlete")
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(stravaAPIURL, "/")+"/athlete", nil)
+	if err != nil {
+		checks["strava_api"] = CheckStatus{Status: "error", Message: err.Error()}
+		return checks
+	}
+	stravaResp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		checks["strava_api"] = CheckStatus{
 			Status:  "error",
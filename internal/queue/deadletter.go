@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/storage"
+)
+
+// ErrJobNotFound is returned when a dead-lettered job does not exist
+var ErrJobNotFound = errors.New("job not found")
+
+var jobIDPattern = regexp.MustCompile(`^[0-9]{20}-[0-9a-f]{12}$`)
+
+// DeadLetters gives access to jobs that failed permanently or ran out of
+// attempts, so they can be inspected and replayed or discarded.
+type DeadLetters interface {
+	// DeadLetters lists failed jobs, oldest first
+	DeadLetters(ctx context.Context) ([]*Job, error)
+	// DeadLetter returns a single failed job
+	DeadLetter(ctx context.Context, id string) (*Job, error)
+	// Replay moves a failed job back into the queue with a fresh attempt count
+	Replay(ctx context.Context, id string) (*Job, error)
+	// Discard deletes a failed job
+	Discard(ctx context.Context, id string) error
+}
+
+func (q *StoreQueue) deadKey(id string) string {
+	return q.deadPrefix + id + ".json"
+}
+
+func (q *StoreQueue) Bury(ctx context.Context, job *Job, cause error) error {
+	job.LeaseUntil = time.Time{}
+	job.FailedAt = time.Now().UTC()
+	if cause != nil {
+		job.LastError = cause.Error()
+	}
+
+	// Write the dead letter first so a failure in between leaves a duplicate
+	// rather than losing the job
+	if err := q.store.Set(ctx, q.deadKey(job.ID), job); err != nil {
+		return fmt.Errorf("failed to store dead letter: %v", err)
+	}
+	if err := q.store.Delete(ctx, q.key(job)); err != nil {
+		return err
+	}
+	return q.deleteLeases(ctx, job.ID)
+}
+
+func (q *StoreQueue) DeadLetters(ctx context.Context) ([]*Job, error) {
+	keys, err := q.store.List(ctx, q.deadPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %v", err)
+	}
+
+	jobs := []*Job{}
+	for _, key := range keys {
+		var job Job
+		if err := q.store.Load(ctx, key, &job); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to load dead letter %s: %v", key, err)
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (q *StoreQueue) DeadLetter(ctx context.Context, id string) (*Job, error) {
+	if !jobIDPattern.MatchString(id) {
+		return nil, ErrJobNotFound
+	}
+
+	var job Job
+	if err := q.store.Load(ctx, q.deadKey(id), &job); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to load dead letter %s: %v", id, err)
+	}
+	return &job, nil
+}
+
+func (q *StoreQueue) Replay(ctx context.Context, id string) (*Job, error) {
+	job, err := q.DeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Attempts = 0
+	job.NextAttempt = time.Now().UTC()
+	job.FailedAt = time.Time{}
+	if err := q.store.Set(ctx, q.key(job), job); err != nil {
+		return nil, fmt.Errorf("failed to requeue job %s: %v", id, err)
+	}
+	if err := q.store.Delete(ctx, q.deadKey(id)); err != nil {
+		return nil, fmt.Errorf("failed to remove dead letter %s: %v", id, err)
+	}
+	return job, nil
+}
+
+func (q *StoreQueue) Discard(ctx context.Context, id string) error {
+	if _, err := q.DeadLetter(ctx, id); err != nil {
+		return err
+	}
+	return q.store.Delete(ctx, q.deadKey(id))
+}
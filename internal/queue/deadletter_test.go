@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buryOne(t *testing.T, q *StoreQueue) *Job {
+	ctx := context.Background()
+	t.Helper()
+	job, err := q.Enqueue(ctx, payload{ObjectID: 1})
+	require.NoError(t, err)
+	job.Attempts = 3
+	require.NoError(t, q.Bury(ctx, job, errors.New("strava returned 503")))
+	return job
+}
+
+func TestStoreQueue_Bury(t *testing.T) {
+	ctx := context.Background()
+	q := NewStoreQueue(storage.NewMemoryStore(), "test")
+	job := buryOne(t, q)
+
+	// Buried jobs are no longer claimable
+	jobs, err := q.Claim(ctx, time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	dead, err := q.DeadLetter(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, dead.Attempts)
+	assert.Equal(t, "strava returned 503", dead.LastError)
+	assert.False(t, dead.FailedAt.IsZero())
+
+	var p payload
+	require.NoError(t, dead.Decode(&p))
+	assert.Equal(t, int64(1), p.ObjectID)
+}
+
+func TestStoreQueue_Replay(t *testing.T) {
+	ctx := context.Background()
+	q := NewStoreQueue(storage.NewMemoryStore(), "test")
+	job := buryOne(t, q)
+
+	replayed, err := q.Replay(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, replayed.Attempts)
+
+	dead, err := q.DeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	jobs, err := q.Claim(ctx, time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, job.ID, jobs[0].ID)
+}
+
+func TestStoreQueue_Discard(t *testing.T) {
+	ctx := context.Background()
+	q := NewStoreQueue(storage.NewMemoryStore(), "test")
+	job := buryOne(t, q)
+
+	require.NoError(t, q.Discard(ctx, job.ID))
+
+	_, err := q.DeadLetter(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	assert.ErrorIs(t, q.Discard(ctx, job.ID), ErrJobNotFound)
+}
+
+func TestStoreQueue_DeadLetterRejectsInvalidIDs(t *testing.T) {
+	ctx := context.Background()
+	q := NewStoreQueue(storage.NewMemoryStore(), "test")
+
+	for _, id := range []string{"", "../queue/test/x", "abc"} {
+		_, err := q.DeadLetter(ctx, id)
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	}
+}
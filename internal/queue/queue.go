@@ -0,0 +1,315 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/storage"
+)
+
+// Job is a unit of work persisted in a queue
+type Job struct {
+	ID          string          `json:"id"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LeaseUntil  time.Time       `json:"lease_until,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	FailedAt    time.Time       `json:"failed_at,omitempty"`
+	// Leases counts the claims of the job and numbers its next lease key
+	Leases int `json:"leases,omitempty"`
+}
+
+// Decode unmarshals the job payload into v
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Queue is a durable FIFO-ish job queue with leases and delayed retries
+type Queue interface {
+	// Enqueue stores a new job that is due immediately
+	Enqueue(ctx context.Context, payload interface{}) (*Job, error)
+	// Claim leases up to n jobs that are due at now. Leased jobs are not
+	// returned again until the lease expires.
+	Claim(ctx context.Context, now time.Time, n int, lease time.Duration) ([]*Job, error)
+	// Complete removes a finished job
+	Complete(ctx context.Context, job *Job) error
+	// Retry schedules a job for another attempt at next
+	Retry(ctx context.Context, job *Job, next time.Time, cause error) error
+	// Bury moves a job that will not be retried to the dead letters
+	Bury(ctx context.Context, job *Job, cause error) error
+	// Pending reports whether a job is still queued, i.e. neither completed
+	// nor dead-lettered
+	Pending(ctx context.Context, id string) (bool, error)
+}
+
+// StoreQueue keeps jobs in a storage.Store under queue/<name>/<due>-<id>.json,
+// so pending work survives restarts. Keys list in order of the time the job
+// is due, so Claim stops at the first job that is not, without loading the
+// rest. Failed jobs are kept under deadletter/<name>/<id>.json.
+//
+// Several instances may share the store, so a job is leased by creating
+// lease/<name>/<id>/<n>.json, which only one claimer can do. Once that lease
+// expires the next claimer creates lease n+1.
+type StoreQueue struct {
+	store       storage.Store
+	prefix      string
+	deadPrefix  string
+	leasePrefix string
+}
+
+// jobLease is stored under a lease key while a claimer holds the job
+type jobLease struct {
+	Until time.Time `json:"until"`
+}
+
+func NewStoreQueue(store storage.Store, name string) *StoreQueue {
+	return &StoreQueue{
+		store:       store,
+		prefix:      fmt.Sprintf("queue/%s/", name),
+		deadPrefix:  fmt.Sprintf("deadletter/%s/", name),
+		leasePrefix: fmt.Sprintf("lease/%s/", name),
+	}
+}
+
+// key is where a job is stored while it is due at job.NextAttempt
+func (q *StoreQueue) key(job *Job) string {
+	return fmt.Sprintf("%s%020d-%s.json", q.prefix, job.NextAttempt.UnixNano(), job.ID)
+}
+
+// parseKey returns the due time and ID of the job stored under key. Keys from
+// before the due time was part of them hold only the ID; legacy is true for
+// those.
+func (q *StoreQueue) parseKey(key string) (due int64, id string, legacy bool, err error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(key, q.prefix), ".json")
+	if jobIDPattern.MatchString(name) {
+		return 0, name, true, nil
+	}
+	dueText, id, found := strings.Cut(name, "-")
+	if !found {
+		return 0, "", false, fmt.Errorf("invalid job key %s", key)
+	}
+	due, err = strconv.ParseInt(dueText, 10, 64)
+	if err != nil {
+		return 0, "", false, fmt.Errorf("invalid job key %s: %v", key, err)
+	}
+	return due, id, false, nil
+}
+
+func (q *StoreQueue) leaseKey(id string, n int) string {
+	return fmt.Sprintf("%s%s/%d.json", q.leasePrefix, id, n)
+}
+
+func (q *StoreQueue) Enqueue(ctx context.Context, payload interface{}) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %v", err)
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:          id,
+		Payload:     data,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+
+	if err := q.store.Set(ctx, q.key(job), job); err != nil {
+		return nil, fmt.Errorf("failed to store job: %v", err)
+	}
+	return job, nil
+}
+
+func (q *StoreQueue) Claim(ctx context.Context, now time.Time, n int, lease time.Duration) ([]*Job, error) {
+	keys, err := q.store.List(ctx, q.prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %v", err)
+	}
+
+	jobs := []*Job{}
+	for _, key := range keys {
+		if len(jobs) >= n {
+			break
+		}
+
+		due, _, legacy, err := q.parseKey(key)
+		if err != nil {
+			log.Printf("Warning: skipping job: %v", err)
+			continue
+		}
+		if due > now.UnixNano() {
+			break // every later key is due later still
+		}
+
+		var job Job
+		if err := q.store.Load(ctx, key, &job); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue // completed by someone else meanwhile
+			}
+			return jobs, fmt.Errorf("failed to load job %s: %v", key, err)
+		}
+		if legacy {
+			if err := q.move(ctx, key, &job); err != nil {
+				return jobs, err
+			}
+		}
+
+		if now.Before(job.NextAttempt) || now.Before(job.LeaseUntil) {
+			continue
+		}
+
+		leased, err := q.lease(ctx, &job, now, lease)
+		if err != nil {
+			return jobs, err
+		}
+		if leased != nil {
+			jobs = append(jobs, leased)
+		}
+	}
+
+	return jobs, nil
+}
+
+// move stores a job under its key and removes it from the old one. The new
+// key is written first, so a failure in between leaves a duplicate rather
+// than losing the job.
+func (q *StoreQueue) move(ctx context.Context, from string, job *Job) error {
+	to := q.key(job)
+	if to == from {
+		return q.store.Set(ctx, to, job)
+	}
+	if err := q.store.Set(ctx, to, job); err != nil {
+		return fmt.Errorf("failed to store job %s: %v", job.ID, err)
+	}
+	if err := q.store.Delete(ctx, from); err != nil {
+		return fmt.Errorf("failed to remove old key of job %s: %v", job.ID, err)
+	}
+	return nil
+}
+
+// lease takes the next lease of the job. It returns nil when another claimer
+// holds the lease or the job was completed or rescheduled meanwhile.
+func (q *StoreQueue) lease(ctx context.Context, job *Job, now time.Time, lease time.Duration) (*Job, error) {
+	held := jobLease{Until: now.Add(lease)}
+	n := job.Leases
+	for {
+		created, err := q.store.Create(ctx, q.leaseKey(job.ID, n), held)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lease job %s: %v", job.ID, err)
+		}
+		if created {
+			break
+		}
+
+		// Someone else took lease n; move on only once it has expired
+		var other jobLease
+		if err := q.store.Load(ctx, q.leaseKey(job.ID, n), &other); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("failed to load lease of job %s: %v", job.ID, err)
+		}
+		if now.Before(other.Until) {
+			return nil, nil
+		}
+		n++
+	}
+
+	// The job we loaded may be stale: read it again now that we hold it
+	var current Job
+	if err := q.store.Load(ctx, q.key(job), &current); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			q.store.Delete(ctx, q.leaseKey(job.ID, n))
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load job %s: %v", job.ID, err)
+	}
+	if now.Before(current.NextAttempt) {
+		q.release(ctx, job.ID, n)
+		return nil, nil
+	}
+
+	current.Leases = n + 1
+	current.LeaseUntil = held.Until
+	if err := q.store.Set(ctx, q.key(&current), &current); err != nil {
+		return nil, fmt.Errorf("failed to lease job %s: %v", job.ID, err)
+	}
+	return &current, nil
+}
+
+// release ends lease n early so the job can be claimed again right away
+func (q *StoreQueue) release(ctx context.Context, id string, n int) error {
+	return q.store.Set(ctx, q.leaseKey(id, n), jobLease{})
+}
+
+// deleteLeases removes the lease keys of a job that left the queue
+func (q *StoreQueue) deleteLeases(ctx context.Context, id string) error {
+	keys, err := q.store.List(ctx, q.leasePrefix+id+"/")
+	if err != nil {
+		return fmt.Errorf("failed to list leases of job %s: %v", id, err)
+	}
+	for _, key := range keys {
+		if err := q.store.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete lease %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// Complete removes the job, then its leases. A claimer that takes a lease in
+// between finds the job gone.
+func (q *StoreQueue) Complete(ctx context.Context, job *Job) error {
+	if err := q.store.Delete(ctx, q.key(job)); err != nil {
+		return err
+	}
+	return q.deleteLeases(ctx, job.ID)
+}
+
+func (q *StoreQueue) Retry(ctx context.Context, job *Job, next time.Time, cause error) error {
+	from := q.key(job)
+	job.NextAttempt = next
+	job.LeaseUntil = time.Time{}
+	if cause != nil {
+		job.LastError = cause.Error()
+	}
+	if err := q.move(ctx, from, job); err != nil {
+		return err
+	}
+	if job.Leases == 0 {
+		return nil
+	}
+	return q.release(ctx, job.ID, job.Leases-1)
+}
+
+func (q *StoreQueue) Pending(ctx context.Context, id string) (bool, error) {
+	keys, err := q.store.List(ctx, q.prefix)
+	if err != nil {
+		return false, fmt.Errorf("failed to list jobs: %v", err)
+	}
+	for _, key := range keys {
+		if _, keyID, _, err := q.parseKey(key); err == nil && keyID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newJobID returns a time-ordered unique ID so keys list in enqueue order
+func newJobID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %v", err)
+	}
+	return fmt.Sprintf("%020d-%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
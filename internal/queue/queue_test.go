@@ -0,0 +1,249 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type payload struct {
+	ObjectID int64 `json:"object_id"`
+}
+
+func TestStoreQueue_EnqueueClaimComplete(t *testing.T) {
+	ctx := context.Background()
+	q := NewStoreQueue(storage.NewMemoryStore(), "test")
+
+	first, err := q.Enqueue(ctx, payload{ObjectID: 1})
+	require.NoError(t, err)
+	_, err = q.Enqueue(ctx, payload{ObjectID: 2})
+	require.NoError(t, err)
+
+	jobs, err := q.Claim(ctx, time.Now(), 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, first.ID, jobs[0].ID, "jobs are claimed in enqueue order")
+
+	var p payload
+	require.NoError(t, jobs[0].Decode(&p))
+	assert.Equal(t, int64(1), p.ObjectID)
+
+	// The leased job is skipped, the next one is handed out
+	jobs, err = q.Claim(ctx, time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.NoError(t, jobs[0].Decode(&p))
+	assert.Equal(t, int64(2), p.ObjectID)
+
+	// Once the lease expires the first job is available again
+	jobs, err = q.Claim(ctx, time.Now().Add(2*time.Minute), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+
+	pending, err := q.Pending(ctx, first.ID)
+	require.NoError(t, err)
+	assert.True(t, pending)
+	for _, job := range jobs {
+		require.NoError(t, q.Complete(ctx, job))
+	}
+	pending, err = q.Pending(ctx, first.ID)
+	require.NoError(t, err)
+	assert.False(t, pending)
+	jobs, err = q.Claim(ctx, time.Now().Add(time.Hour), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestStoreQueue_RetryDelaysJob(t *testing.T) {
+	ctx := context.Background()
+	q := NewStoreQueue(storage.NewMemoryStore(), "test")
+	_, err := q.Enqueue(ctx, payload{ObjectID: 1})
+	require.NoError(t, err)
+
+	jobs, err := q.Claim(ctx, time.Now(), 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+
+	next := time.Now().Add(10 * time.Minute)
+	require.NoError(t, q.Retry(ctx, jobs[0], next, errors.New("boom")))
+
+	jobs, err = q.Claim(ctx, time.Now(), 1, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	jobs, err = q.Claim(ctx, next, 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "boom", jobs[0].LastError)
+}
+
+func TestStoreQueue_SurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	_, err := NewStoreQueue(store, "test").Enqueue(ctx, payload{ObjectID: 1})
+	require.NoError(t, err)
+
+	jobs, err := NewStoreQueue(store, "test").Claim(ctx, time.Now(), 1, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	jobs, err = NewStoreQueue(store, "other").Claim(ctx, time.Now(), 1, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+// countingStore counts the jobs loaded from the store
+type countingStore struct {
+	storage.Store
+	mu    sync.Mutex
+	loads int
+}
+
+func (s *countingStore) Load(ctx context.Context, key string, v interface{}) error {
+	s.mu.Lock()
+	s.loads++
+	s.mu.Unlock()
+	return s.Store.Load(ctx, key, v)
+}
+
+// Jobs that are not due yet are not even loaded
+func TestStoreQueue_ClaimStopsAtFirstJobNotDue(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{Store: storage.NewMemoryStore()}
+	q := NewStoreQueue(store, "test")
+
+	later := time.Now().Add(time.Hour)
+	for i := 0; i < 20; i++ {
+		job, err := q.Enqueue(ctx, payload{ObjectID: int64(i)})
+		require.NoError(t, err)
+		require.NoError(t, q.Retry(ctx, job, later, errors.New("later")))
+	}
+	due, err := q.Enqueue(ctx, payload{ObjectID: 99})
+	require.NoError(t, err)
+
+	store.loads = 0
+	jobs, err := q.Claim(ctx, time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, due.ID, jobs[0].ID)
+	assert.LessOrEqual(t, store.loads, 3, "only the due job and its lease are read")
+	require.NoError(t, q.Complete(ctx, jobs[0]))
+
+	jobs, err = q.Claim(ctx, later, 30, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 20)
+}
+
+// Jobs stored before keys held the due time are still claimed
+func TestStoreQueue_ClaimsLegacyKeys(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	q := NewStoreQueue(store, "test")
+
+	id, err := newJobID()
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	require.NoError(t, store.Set(ctx, "queue/test/"+id+".json", &Job{ID: id, Payload: []byte(`{}`), CreatedAt: now, NextAttempt: now}))
+
+	jobs, err := q.Claim(ctx, time.Now(), 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, id, jobs[0].ID)
+	require.NoError(t, q.Complete(ctx, jobs[0]))
+
+	keys, err := store.List(ctx, "queue/test/")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+// slowStore widens the gap between reading a job and leasing it, as a remote
+// store would
+type slowStore struct {
+	storage.Store
+}
+
+func (s slowStore) Load(ctx context.Context, key string, v interface{}) error {
+	err := s.Store.Load(ctx, key, v)
+	time.Sleep(time.Millisecond)
+	return err
+}
+
+// Two instances sharing a store must never hand out the same job twice
+func TestStoreQueue_ClaimIsExclusiveAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	store := slowStore{storage.NewMemoryStore()}
+	for i := 0; i < 20; i++ {
+		_, err := NewStoreQueue(store, "test").Enqueue(ctx, payload{ObjectID: int64(i)})
+		require.NoError(t, err)
+	}
+
+	var mu sync.Mutex
+	claims := map[string]int{}
+	var wg sync.WaitGroup
+	for _, q := range []*StoreQueue{NewStoreQueue(store, "test"), NewStoreQueue(store, "test")} {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(q *StoreQueue) {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					jobs, err := q.Claim(ctx, time.Now(), 3, time.Minute)
+					assert.NoError(t, err)
+					mu.Lock()
+					for _, job := range jobs {
+						claims[job.ID]++
+					}
+					mu.Unlock()
+				}
+			}(q)
+		}
+	}
+	wg.Wait()
+
+	assert.Len(t, claims, 20)
+	for id, n := range claims {
+		assert.Equal(t, 1, n, id)
+	}
+}
+
+func TestStoreQueue_LeaseHandsOverBetweenInstances(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	a, b := NewStoreQueue(store, "test"), NewStoreQueue(store, "test")
+	_, err := a.Enqueue(ctx, payload{ObjectID: 1})
+	require.NoError(t, err)
+
+	now := time.Now()
+	jobs, err := a.Claim(ctx, now, 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	held := jobs[0]
+
+	jobs, err = b.Claim(ctx, now, 1, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, jobs, "the job is leased by the other instance")
+
+	// A retry releases the lease for whoever claims next
+	require.NoError(t, a.Retry(ctx, held, now, errors.New("boom")))
+	jobs, err = b.Claim(ctx, now, 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+
+	// An expired lease is taken over, a completed job is not
+	jobs, err = a.Claim(ctx, now.Add(2*time.Minute), 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.NoError(t, a.Complete(ctx, jobs[0]))
+
+	jobs, err = b.Claim(ctx, now.Add(time.Hour), 1, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+	leases, err := store.List(ctx, "lease/")
+	require.NoError(t, err)
+	assert.Empty(t, leases)
+}
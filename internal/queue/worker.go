@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Handler processes a job. Returning an error schedules a retry unless the
+// error is wrapped with Permanent. RetryAt sets when the retry happens.
+type Handler func(ctx context.Context, job *Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+type delayedError struct {
+	err error
+	at  time.Time
+}
+
+func (e *delayedError) Error() string { return e.err.Error() }
+func (e *delayedError) Unwrap() error { return e.err }
+
+// RetryAt asks for the job to be retried no earlier than at, for example when
+// an API has told us to back off. The attempt does not count towards
+// MaxAttempts.
+func RetryAt(err error, at time.Time) error {
+	if err == nil {
+		return nil
+	}
+	return &delayedError{err: err, at: at}
+}
+
+// WorkerOptions tunes how a Worker polls and retries
+type WorkerOptions struct {
+	Concurrency  int
+	PollInterval time.Duration
+	Lease        time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+}
+
+func (o *WorkerOptions) setDefaults() {
+	if o.Concurrency <= 0 {
+		o.Concurrency = 2
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	if o.Lease <= 0 {
+		o.Lease = 2 * time.Minute
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 8
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 5 * time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+}
+
+// Worker claims due jobs from a Queue and runs them through a Handler
+type Worker struct {
+	queue   Queue
+	handler Handler
+	opts    WorkerOptions
+}
+
+func NewWorker(queue Queue, handler Handler, opts WorkerOptions) *Worker {
+	opts.setDefaults()
+	return &Worker{
+		queue:   queue,
+		handler: handler,
+		opts:    opts,
+	}
+}
+
+// Run polls the queue until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.ProcessDue(ctx); err != nil {
+			log.Printf("Queue worker error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue claims the jobs that are currently due and processes them,
+// returning how many were handled.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	jobs, err := w.queue.Claim(ctx, time.Now(), w.opts.Concurrency, w.opts.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			w.process(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+
+	return len(jobs), nil
+}
+
+func (w *Worker) process(ctx context.Context, job *Job) {
+	job.Attempts++
+
+	// A job that outlives its lease could be claimed and run a second time
+	jobCtx, cancel := context.WithTimeout(ctx, w.opts.Lease)
+	err := w.handler(jobCtx, job)
+	cancel()
+	if err == nil {
+		if err := w.queue.Complete(ctx, job); err != nil {
+			log.Printf("Failed to complete job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	var delayed *delayedError
+	if errors.As(err, &delayed) {
+		job.Attempts--
+		log.Printf("Job %s deferred until %s: %v", job.ID, delayed.at.Format(time.RFC3339), err)
+		if err := w.queue.Retry(ctx, job, delayed.at, err); err != nil {
+			log.Printf("Failed to reschedule job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	if IsPermanent(err) || job.Attempts >= w.opts.MaxAttempts {
+		log.Printf("Giving up on job %s after %d attempts: %v", job.ID, job.Attempts, err)
+		if err := w.queue.Bury(ctx, job, err); err != nil {
+			log.Printf("Failed to dead-letter job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	delay := Backoff(job.Attempts, w.opts.BaseBackoff, w.opts.MaxBackoff)
+	log.Printf("Job %s failed (attempt %d), retrying in %v: %v", job.ID, job.Attempts, delay, err)
+	if err := w.queue.Retry(ctx, job, time.Now().Add(delay), err); err != nil {
+		log.Printf("Failed to reschedule job %s: %v", job.ID, err)
+	}
+}
+
+// Backoff returns the exponential delay before the given retry attempt
+// (1-based), capped at max.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
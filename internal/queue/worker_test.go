@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	base := time.Second
+	max := 10 * time.Second
+
+	assert.Equal(t, 1*time.Second, Backoff(1, base, max))
+	assert.Equal(t, 2*time.Second, Backoff(2, base, max))
+	assert.Equal(t, 8*time.Second, Backoff(4, base, max))
+	assert.Equal(t, max, Backoff(5, base, max))
+	assert.Equal(t, max, Backoff(50, base, max))
+}
+
+// fastOptions makes retries due immediately so tests can drive the worker
+var fastOptions = WorkerOptions{
+	BaseBackoff: time.Nanosecond,
+	MaxBackoff:  time.Nanosecond,
+	MaxAttempts: 3,
+}
+
+func drain(t *testing.T, w *Worker) {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		n, err := w.ProcessDue(context.Background())
+		require.NoError(t, err)
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorker_RetriesUntilSuccess(t *testing.T) {
+	ctx := context.Background()
+	q := NewStoreQueue(storage.NewMemoryStore(), "test")
+	_, err := q.Enqueue(ctx, payload{ObjectID: 1})
+	require.NoError(t, err)
+
+	calls := 0
+	w := NewWorker(q, func(ctx context.Context, job *Job) error {
+		calls++
+		if calls < 2 {
+			return errors.New("temporary")
+		}
+		return nil
+	}, fastOptions)
+
+	drain(t, w)
+	assert.Equal(t, 2, calls)
+
+	jobs, err := q.Claim(ctx, time.Now().Add(time.Hour), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestWorker_GivesUp(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name          string
+		err           error
+		expectedCalls int
+	}{
+		{name: "max attempts", err: errors.New("always failing"), expectedCalls: 3},
+		{name: "permanent error", err: Permanent(errors.New("no tokens")), expectedCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewStoreQueue(storage.NewMemoryStore(), "test")
+			_, err := q.Enqueue(ctx, payload{ObjectID: 1})
+			require.NoError(t, err)
+
+			calls := 0
+			w := NewWorker(q, func(ctx context.Context, job *Job) error {
+				calls++
+				return tt.err
+			}, fastOptions)
+
+			drain(t, w)
+			assert.Equal(t, tt.expectedCalls, calls)
+
+			dead, err := q.DeadLetters(ctx)
+			require.NoError(t, err)
+			require.Len(t, dead, 1)
+			assert.Equal(t, tt.expectedCalls, dead[0].Attempts)
+			assert.Equal(t, tt.err.Error(), dead[0].LastError)
+			assert.False(t, dead[0].FailedAt.IsZero())
+		})
+	}
+}
+
+func TestWorker_RetryAtDefersWithoutCountingAttempt(t *testing.T) {
+	ctx := context.Background()
+	q := NewStoreQueue(storage.NewMemoryStore(), "test")
+	_, err := q.Enqueue(ctx, payload{ObjectID: 1})
+	require.NoError(t, err)
+
+	resetAt := time.Now().Add(10 * time.Minute)
+	calls := 0
+	w := NewWorker(q, func(ctx context.Context, job *Job) error {
+		calls++
+		return RetryAt(errors.New("rate limited"), resetAt)
+	}, fastOptions)
+
+	drain(t, w)
+	assert.Equal(t, 1, calls, "the job must wait for the reset")
+
+	jobs, err := q.Claim(ctx, resetAt, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, 0, jobs[0].Attempts)
+	assert.Equal(t, "rate limited", jobs[0].LastError)
+}
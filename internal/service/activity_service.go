@@ -1,87 +1,105 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
-	"time"
 
+	"github.com/guisithos/go-ride-names/internal/defaultnames"
 	"github.com/guisithos/go-ride-names/internal/strava"
 )
 
-var defaultActivityNames = map[string]bool{
-	"Morning Run":               true,
-	"Afternoon Run":             true,
-	"Lunch Run":                 true,
-	"Evening Run":               true,
-	"Night Run":                 true,
-	"Morning Ride":              true,
-	"Afternoon Ride":            true,
-	"Lunch Ride":                true,
-	"Evening Ride":              true,
-	"Night Ride":                true,
-	"Morning Walk":              true,
-	"Afternoon Walk":            true,
-	"Lunch Walk":                true,
-	"Evening Walk":              true,
-	"Night Walk":                true,
-	"Morning Weight Training":   true,
-	"Afternoon Weight Training": true,
-	"Lunch Weight Training":     true,
-	"Evening Weight Training":   true,
-	"Night Weight Training":     true,
-	"Morning Swim":              true,
-	"Afternoon Swim":            true,
-	"Lunch Swim":                true,
-	"Evening Swim":              true,
-	"Night Swim":                true,
-	"Morning Yoga":              true,
-	"Afternoon Yoga":            true,
-	"Lunch Yoga":                true,
-	"Evening Yoga":              true,
-	"Night Yoga":                true,
+// isDefaultName reports whether name is a title Strava gave the activity, in
+// any of the languages Strava supports
+func isDefaultName(name string) bool {
+	return defaultnames.IsDefault(name)
 }
 
 type ActivityService struct {
-	client strava.StravaClientInterface
+	client   strava.StravaClientInterface
+	onRename RenameHook
+	undone   UndoneFunc
 }
 
+// Rename describes a rename made on Strava
+type Rename struct {
+	ActivityID int64
+	OldName    string
+	NewName    string
+	JokeID     string
+}
+
+// RenameHook is called after every rename the service makes
+type RenameHook func(ctx context.Context, rename Rename)
+
+// UndoneFunc reports whether the athlete undid our latest rename of an
+// activity, so it must keep the name they restored
+type UndoneFunc func(ctx context.Context, activityID int64) (bool, error)
+
 func NewActivityService(client strava.StravaClientInterface) *ActivityService {
 	return &ActivityService{
 		client: client,
 	}
 }
 
-func (s *ActivityService) GetAuthenticatedAthlete() (*strava.Athlete, error) {
-	return s.client.GetAuthenticatedAthlete()
+// OnRename sets the hook called after every rename, for keeping a history
+func (s *ActivityService) OnRename(hook RenameHook) {
+	s.onRename = hook
+}
+
+func (s *ActivityService) renamed(ctx context.Context, rename Rename) {
+	if s.onRename != nil {
+		s.onRename(ctx, rename)
+	}
+}
+
+// SkipUndone sets the check that keeps activities whose rename was undone
+// from being renamed again
+func (s *ActivityService) SkipUndone(undone UndoneFunc) {
+	s.undone = undone
 }
 
-func (s *ActivityService) ListActivities(page, perPage int, before, after int64, updateNames bool) ([]strava.Activity, error) {
-	activities, err := s.client.GetAthleteActivities(page, perPage, before, after)
+func (s *ActivityService) wasUndone(ctx context.Context, activityID int64) (bool, error) {
+	if s.undone == nil {
+		return false, nil
+	}
+	undone, err := s.undone(ctx, activityID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check undo of activity %d: %v", activityID, err)
+	}
+	return undone, nil
+}
+
+func (s *ActivityService) GetAuthenticatedAthlete(ctx context.Context) (*strava.Athlete, error) {
+	return s.client.GetAuthenticatedAthlete(ctx)
+}
+
+func (s *ActivityService) ListActivities(ctx context.Context, page, perPage int, before, after int64, updateNames bool) ([]strava.Activity, error) {
+	activities, err := s.client.GetAthleteActivities(ctx, page, perPage, before, after)
 	if err != nil {
-		return nil, fmt.Errorf("error getting activities: %v", err)
+		return nil, fmt.Errorf("error getting activities: %w", err)
 	}
 
 	if updateNames {
-		for i := range activities {
-			if err := s.UpdateActivityWithFunName(&activities[i]); err != nil {
-				log.Printf("Warning: failed to update activity %d: %v", activities[i].ID, err)
-			}
+		if _, err := s.RenameActivities(ctx, activities); err != nil {
+			return activities, err
 		}
 	}
 
 	return activities, nil
 }
 
-func (s *ActivityService) UpdateActivityWithFunName(activity *strava.Activity) error {
+func (s *ActivityService) UpdateActivityWithFunName(ctx context.Context, activity *strava.Activity) error {
 	// Check if the activity has a default name
-	if !defaultActivityNames[activity.Name] {
+	if !isDefaultName(activity.Name) {
 		return nil // Not a default name, no need to update
 	}
 
 	// Get activity type using both name and sport_type
 	activityType := getActivityType(activity.Name, activity.SportType)
-	joke := getRandomJoke(activityType)
+	joke, jokeID := getRandomJoke(activityType)
 
 	// Log the name change
 	fmt.Printf("Updating activity name:\n  From: %s\n  Type: %s\n  To:   %s\n\n",
@@ -90,57 +108,74 @@ func (s *ActivityService) UpdateActivityWithFunName(activity *strava.Activity) e
 		joke)
 
 	// Update the activity name
-	if err := s.client.UpdateActivity(activity.ID, joke); err != nil {
-		return fmt.Errorf("error updating activity: %v", err)
+	if err := s.client.UpdateActivity(ctx, activity.ID, joke); err != nil {
+		return fmt.Errorf("error updating activity: %w", err)
 	}
 
+	s.renamed(ctx, Rename{ActivityID: activity.ID, OldName: activity.Name, NewName: joke, JokeID: jokeID})
+
 	// Update the local activity name
 	activity.Name = joke
 	return nil
 }
 
-// Create a package-level random number generator
-var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
-
-func getRandomJoke(activityType string) string {
+// getRandomJoke picks a joke for the activity type and returns it with its
+// ID, "<type>/<index>"
+func getRandomJoke(activityType string) (string, string) {
 	jokes, exists := activityJokes[activityType]
 	if !exists || len(jokes) == 0 {
+		activityType = Default
 		jokes = activityJokes[Default]
 	}
-	return jokes[rng.Intn(len(jokes))]
+	i := rand.Intn(len(jokes))
+	return jokes[i], jokeID(activityType, i)
+}
+
+func jokeID(activityType string, index int) string {
+	return fmt.Sprintf("%s/%d", activityType, index)
 }
 
-func (s *ActivityService) ProcessNewActivity(activityID int64) error {
-	activity, err := s.client.GetActivity(activityID)
+func (s *ActivityService) ProcessNewActivity(ctx context.Context, activityID int64) error {
+	activity, err := s.client.GetActivity(ctx, activityID)
 	if err != nil {
-		return fmt.Errorf("error getting activity: %v", err)
+		return fmt.Errorf("error getting activity: %w", err)
 	}
 
 	// Only process if it has a default name
-	if defaultActivityNames[activity.Name] {
-		return s.UpdateActivityWithFunName(activity)
+	if isDefaultName(activity.Name) {
+		return s.UpdateActivityWithFunName(ctx, activity)
 	}
 
 	return nil
 }
 
-// RenameActivity renames a specific activity with a fun name
-func (s *ActivityService) RenameActivity(activityID int64) error {
+// RenameActivity renames a specific activity with a fun name. It reports
+// whether the activity was renamed; activities without a default name are
+// left untouched.
+func (s *ActivityService) RenameActivity(ctx context.Context, activityID int64) (bool, error) {
 	// Get activity details
-	activity, err := s.client.GetActivity(activityID)
+	activity, err := s.client.GetActivity(ctx, activityID)
 	if err != nil {
-		return fmt.Errorf("failed to get activity: %v", err)
+		return false, fmt.Errorf("failed to get activity: %w", err)
 	}
 
 	// Only rename if it has a default name
-	if !defaultActivityNames[activity.Name] {
+	if !isDefaultName(activity.Name) {
 		log.Printf("Activity '%s' doesn't have a default name, skipping", activity.Name)
-		return nil
+		return false, nil
+	}
+	undone, err := s.wasUndone(ctx, activityID)
+	if err != nil {
+		return false, err
+	}
+	if undone {
+		log.Printf("Rename of activity %d was undone, skipping", activityID)
+		return false, nil
 	}
 
 	// Use our existing name generation logic
 	activityType := getActivityType(activity.Name, activity.SportType)
-	newName := getRandomJoke(activityType)
+	newName, jokeID := getRandomJoke(activityType)
 
 	// Log the name change
 	log.Printf("Updating activity name:\n  From: %s\n  Type: %s\n  To:   %s\n",
@@ -149,9 +184,37 @@ func (s *ActivityService) RenameActivity(activityID int64) error {
 		newName)
 
 	// Update activity name
-	if err := s.client.UpdateActivity(activityID, newName); err != nil {
-		return fmt.Errorf("failed to update activity: %v", err)
+	if err := s.client.UpdateActivity(ctx, activityID, newName); err != nil {
+		return false, fmt.Errorf("failed to update activity: %w", err)
+	}
+	s.renamed(ctx, Rename{ActivityID: activityID, OldName: activity.Name, NewName: newName, JokeID: jokeID})
+
+	return true, nil
+}
+
+// ErrNameChanged means an activity no longer has the name it was expected to
+// have, so writing ours would overwrite the athlete's own edit
+var ErrNameChanged = errors.New("activity was renamed since")
+
+// RestoreName puts back an activity's original name, provided it still has
+// the name we renamed it to
+func (s *ActivityService) RestoreName(ctx context.Context, activityID int64, renamedTo, original string) error {
+	return s.renameFrom(ctx, activityID, renamedTo, original)
+}
+
+// renameFrom renames an activity from one name to another, returning
+// ErrNameChanged if it no longer has the first
+func (s *ActivityService) renameFrom(ctx context.Context, activityID int64, from, to string) error {
+	activity, err := s.client.GetActivity(ctx, activityID)
+	if err != nil {
+		return fmt.Errorf("failed to get activity: %w", err)
+	}
+	if activity.Name != from {
+		return ErrNameChanged
 	}
 
+	if err := s.client.UpdateActivity(ctx, activityID, to); err != nil {
+		return fmt.Errorf("failed to update activity: %w", err)
+	}
 	return nil
 }
@@ -1,11 +1,14 @@
 package service
 
 import (
+	"context"
+	"sync"
 	"testing"
 
 	"github.com/guisithos/go-ride-names/internal/strava"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockStravaClient is a mock implementation of the Strava client
@@ -13,7 +16,7 @@ type MockStravaClient struct {
 	mock.Mock
 }
 
-func (m *MockStravaClient) GetActivity(id int64) (*strava.Activity, error) {
+func (m *MockStravaClient) GetActivity(ctx context.Context, id int64) (*strava.Activity, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -21,12 +24,12 @@ func (m *MockStravaClient) GetActivity(id int64) (*strava.Activity, error) {
 	return args.Get(0).(*strava.Activity), args.Error(1)
 }
 
-func (m *MockStravaClient) UpdateActivity(id int64, name string) error {
+func (m *MockStravaClient) UpdateActivity(ctx context.Context, id int64, name string) error {
 	args := m.Called(id, name)
 	return args.Error(0)
 }
 
-func (m *MockStravaClient) GetAuthenticatedAthlete() (*strava.Athlete, error) {
+func (m *MockStravaClient) GetAuthenticatedAthlete(ctx context.Context) (*strava.Athlete, error) {
 	args := m.Called()
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -34,7 +37,7 @@ func (m *MockStravaClient) GetAuthenticatedAthlete() (*strava.Athlete, error) {
 	return args.Get(0).(*strava.Athlete), args.Error(1)
 }
 
-func (m *MockStravaClient) GetAthleteActivities(page, perPage int, before, after int64) ([]strava.Activity, error) {
+func (m *MockStravaClient) GetAthleteActivities(ctx context.Context, page, perPage int, before, after int64) ([]strava.Activity, error) {
 	args := m.Called(page, perPage, before, after)
 	return args.Get(0).([]strava.Activity), args.Error(1)
 }
@@ -88,7 +91,7 @@ func TestActivityService_RenameActivity(t *testing.T) {
 
 			// Setup mock expectations
 			mockClient.On("GetActivity", tt.activityID).Return(tt.mockActivity, tt.mockError)
-			if tt.mockActivity != nil && defaultActivityNames[tt.mockActivity.Name] {
+			if tt.mockActivity != nil && isDefaultName(tt.mockActivity.Name) {
 				mockClient.On("UpdateActivity", tt.activityID, mock.AnythingOfType("string")).Return(tt.updateError)
 			}
 
@@ -96,13 +99,14 @@ func TestActivityService_RenameActivity(t *testing.T) {
 			service := NewActivityService(mockClient)
 
 			// Execute test
-			err := service.RenameActivity(tt.activityID)
+			renamed, err := service.RenameActivity(context.Background(), tt.activityID)
 
 			// Assert results
 			if tt.expectedError {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, isDefaultName(tt.mockActivity.Name), renamed)
 			}
 
 			// Verify all expectations were met
@@ -158,7 +162,7 @@ func TestActivityService_ListActivities(t *testing.T) {
 
 			if tt.updateNames {
 				for _, activity := range tt.mockActivities {
-					if defaultActivityNames[activity.Name] {
+					if isDefaultName(activity.Name) {
 						mockClient.On("UpdateActivity",
 							activity.ID, mock.AnythingOfType("string")).Return(nil)
 					}
@@ -166,7 +170,7 @@ func TestActivityService_ListActivities(t *testing.T) {
 			}
 
 			service := NewActivityService(mockClient)
-			activities, err := service.ListActivities(tt.page, tt.perPage, tt.before, tt.after, tt.updateNames)
+			activities, err := service.ListActivities(context.Background(), tt.page, tt.perPage, tt.before, tt.after, tt.updateNames)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -180,3 +184,137 @@ func TestActivityService_ListActivities(t *testing.T) {
 		})
 	}
 }
+
+func TestActivityService_OnRename(t *testing.T) {
+	ctx := context.Background()
+	mockClient := new(MockStravaClient)
+	mockClient.On("GetActivity", int64(1)).Return(&strava.Activity{ID: 1, Name: "Morning Swim", SportType: "Swim"}, nil)
+	mockClient.On("UpdateActivity", mock.AnythingOfType("int64"), mock.AnythingOfType("string")).Return(nil)
+
+	s := NewActivityService(mockClient)
+	var renames []Rename
+	s.OnRename(func(ctx context.Context, rename Rename) {
+		renames = append(renames, rename)
+	})
+
+	_, err := s.RenameActivity(ctx, 1)
+	assert.NoError(t, err)
+	activity := &strava.Activity{ID: 2, Name: "Lunch Ride", SportType: "Ride"}
+	assert.NoError(t, s.UpdateActivityWithFunName(ctx, activity))
+
+	if assert.Len(t, renames, 2) {
+		assert.Equal(t, "Morning Swim", renames[0].OldName)
+		assert.Contains(t, activityJokes[Swim], renames[0].NewName)
+		assert.Regexp(t, `^Swim/\d+$`, renames[0].JokeID)
+		assert.Equal(t, int64(2), renames[1].ActivityID)
+		assert.Equal(t, "Lunch Ride", renames[1].OldName)
+		assert.Equal(t, activity.Name, renames[1].NewName)
+	}
+}
+
+func TestActivityService_SkipUndone(t *testing.T) {
+	ctx := context.Background()
+	mockClient := new(MockStravaClient)
+	mockClient.On("GetActivity", int64(1)).Return(&strava.Activity{ID: 1, Name: "Morning Run", SportType: "Run"}, nil)
+	mockClient.On("GetActivity", int64(3)).Return(&strava.Activity{ID: 3, Name: "Night Walk", SportType: "Walk"}, nil)
+	mockClient.On("UpdateActivity", int64(2), mock.AnythingOfType("string")).Return(nil)
+
+	s := NewActivityService(mockClient)
+	s.SkipUndone(func(ctx context.Context, activityID int64) (bool, error) {
+		if activityID == 3 {
+			return false, assert.AnError
+		}
+		return activityID == 1, nil
+	})
+	activities := []strava.Activity{
+		{ID: 1, Name: "Morning Run", SportType: "Run"},
+		{ID: 2, Name: "Lunch Ride", SportType: "Ride"},
+		{ID: 3, Name: "Night Walk", SportType: "Walk"},
+	}
+
+	proposals := s.PlanRenames(ctx, activities)
+	require.Len(t, proposals, 1)
+	assert.Equal(t, int64(2), proposals[0].ActivityID)
+
+	report, err := s.RenameActivities(ctx, activities)
+	require.NoError(t, err)
+	assert.Len(t, report.Renamed, 1)
+	assert.Equal(t, []RenameOutcome{{ActivityID: 1, OldName: "Morning Run", Reason: ReasonUndone}}, report.Skipped)
+	assert.Equal(t, []RenameOutcome{{ActivityID: 3, OldName: "Night Walk", Reason: ReasonError}}, report.Failed)
+
+	renamed, err := s.RenameActivity(ctx, 1)
+	assert.NoError(t, err)
+	assert.False(t, renamed)
+	_, err = s.RenameActivity(ctx, 3)
+	assert.Error(t, err)
+	mockClient.AssertNumberOfCalls(t, "UpdateActivity", 1)
+}
+
+func TestActivityService_RestoreName(t *testing.T) {
+	ctx := context.Background()
+	mockClient := new(MockStravaClient)
+	mockClient.On("GetActivity", int64(1)).Return(&strava.Activity{ID: 1, Name: "joke"}, nil)
+	mockClient.On("GetActivity", int64(2)).Return(&strava.Activity{ID: 2, Name: "My own name"}, nil)
+	mockClient.On("UpdateActivity", int64(1), "Morning Run").Return(nil)
+
+	s := NewActivityService(mockClient)
+	assert.NoError(t, s.RestoreName(ctx, 1, "joke", "Morning Run"))
+	assert.ErrorIs(t, s.RestoreName(ctx, 2, "joke", "Morning Run"), ErrNameChanged)
+	mockClient.AssertNumberOfCalls(t, "UpdateActivity", 1)
+}
+
+func TestGetActivityType(t *testing.T) {
+	tests := []struct {
+		name      string
+		sportType string
+		expected  string
+	}{
+		{"Morning Run", "Run", Run},
+		{"Evening Virtual Ride", "VirtualRide", VirtualRide},
+		// Without a sport_type, the localized default title tells the sport
+		{"Corrida matinal", "", Run},
+		{"Pedalada vespertina", "", Ride},
+		{"Morgenlauf", "", Run},
+		{"Morning Hike", "", Hike},
+		// Sports without jokes of their own
+		{"Morning Gravel Ride", "GravelRide", Ride},
+		{"Morning Activity", "", Default},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, getActivityType(tt.name, tt.sportType), tt.name)
+	}
+}
+
+func TestActivityService_RenamesLocalizedDefaults(t *testing.T) {
+	mockClient := new(MockStravaClient)
+	mockClient.On("UpdateActivity", mock.AnythingOfType("int64"), mock.AnythingOfType("string")).Return(nil)
+
+	report, err := NewActivityService(mockClient).RenameActivities(context.Background(), []strava.Activity{
+		{ID: 1, Name: "Corrida matinal", SportType: "Run"},
+		{ID: 2, Name: "Pedalada vespertina", SportType: "Ride"},
+		{ID: 3, Name: "Morning Hike", SportType: "Hike"},
+		{ID: 4, Name: "Corrida com os amigos", SportType: "Run"},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, report.Renamed, 3)
+	assert.Len(t, report.Skipped, 1)
+}
+
+// Queue workers pick jokes from several goroutines; run with -race
+func TestGetRandomJoke_Concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				joke, _ := getRandomJoke(Run)
+				assert.NotEmpty(t, joke)
+				Reroll(RenameProposal{Type: Ride, NewName: joke})
+			}
+		}()
+	}
+	wg.Wait()
+}
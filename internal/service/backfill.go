@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+)
+
+// DefaultPageSize is how many activities are requested per page when
+// walking an athlete's history; Strava allows up to 200
+const DefaultPageSize = 100
+
+// ActivityPager walks an athlete's activities in a time window, newest first,
+// one page at a time. The window is fixed when the pager is created, so new
+// uploads do not shift the pages.
+type ActivityPager struct {
+	client  strava.StravaClientInterface
+	before  int64
+	after   int64
+	perPage int
+	page    int
+	done    bool
+}
+
+// Pager pages through the activities started after `after` and before
+// `before` (unix seconds, zero for no bound), starting at page startPage.
+func (s *ActivityService) Pager(before, after int64, perPage, startPage int) *ActivityPager {
+	if perPage <= 0 {
+		perPage = DefaultPageSize
+	}
+	if startPage <= 0 {
+		startPage = 1
+	}
+	return &ActivityPager{
+		client:  s.client,
+		before:  before,
+		after:   after,
+		perPage: perPage,
+		page:    startPage,
+	}
+}
+
+// Next fetches the next page. It returns nil once the window is exhausted.
+func (p *ActivityPager) Next(ctx context.Context) ([]strava.Activity, error) {
+	if p.done {
+		return nil, nil
+	}
+
+	activities, err := p.client.GetAthleteActivities(ctx, p.page, p.perPage, p.before, p.after)
+	if err != nil {
+		return nil, fmt.Errorf("error getting activities page %d: %w", p.page, err)
+	}
+
+	p.page++
+	// A short page is the last one
+	if len(activities) < p.perPage {
+		p.done = true
+	}
+	if len(activities) == 0 {
+		return nil, nil
+	}
+	return activities, nil
+}
+
+// Page is the page Next fetches next
+func (p *ActivityPager) Page() int {
+	return p.page
+}
+
+// Done reports whether the window is exhausted
+func (p *ActivityPager) Done() bool {
+	return p.done
+}
+
+// BackfillCursor is the saved position of a backfill, so it can resume
+// where it stopped
+type BackfillCursor struct {
+	Before   int64 `json:"before"`
+	After    int64 `json:"after"`
+	NextPage int   `json:"next_page"`
+	Scanned  int   `json:"scanned"`
+	Renamed  int   `json:"renamed"`
+	Done     bool  `json:"done"`
+}
+
+// CheckpointFunc persists the cursor after every page
+type CheckpointFunc func(ctx context.Context, cursor *BackfillCursor) error
+
+// Backfill renames the default-named activities in the cursor's window,
+// continuing from cursor.NextPage. It checkpoints after every page and stops
+// after maxPages pages (zero for no limit) or when the window is done.
+//
+// A page is checkpointed only once all its activities were handled, so an
+// interrupted page is scanned again; activities renamed the first time no
+// longer have a default name and are skipped.
+func (s *ActivityService) Backfill(ctx context.Context, cursor *BackfillCursor, maxPages int, checkpoint CheckpointFunc) error {
+	pager := s.Pager(cursor.Before, cursor.After, DefaultPageSize, cursor.NextPage)
+
+	for pages := 0; !cursor.Done && (maxPages == 0 || pages < maxPages); pages++ {
+		activities, err := pager.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		report, err := s.RenameActivities(ctx, activities)
+		if err != nil {
+			return err
+		}
+		cursor.Renamed += len(report.Renamed)
+
+		cursor.Scanned += len(activities)
+		cursor.NextPage = pager.Page()
+		cursor.Done = pager.Done()
+		if err := checkpoint(ctx, cursor); err != nil {
+			return fmt.Errorf("failed to checkpoint backfill: %v", err)
+		}
+	}
+
+	return nil
+}
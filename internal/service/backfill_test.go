@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// historyPage returns n activities with IDs starting at first
+func historyPage(first int64, n int, name string) []strava.Activity {
+	activities := make([]strava.Activity, n)
+	for i := range activities {
+		activities[i] = strava.Activity{ID: first + int64(i), Name: name, SportType: "Run"}
+	}
+	return activities
+}
+
+func TestActivityPager(t *testing.T) {
+	ctx := context.Background()
+	mockClient := new(MockStravaClient)
+	mockClient.On("GetAthleteActivities", 1, 2, int64(200), int64(100)).Return(historyPage(1, 2, "Morning Run"), nil)
+	mockClient.On("GetAthleteActivities", 2, 2, int64(200), int64(100)).Return(historyPage(3, 1, "Morning Run"), nil)
+
+	pager := NewActivityService(mockClient).Pager(200, 100, 2, 1)
+
+	page, err := pager.Next(ctx)
+	require.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.False(t, pager.Done())
+
+	page, err = pager.Next(ctx)
+	require.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.True(t, pager.Done(), "a short page is the last one")
+	assert.Equal(t, 3, pager.Page())
+
+	page, err = pager.Next(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, page)
+	mockClient.AssertNumberOfCalls(t, "GetAthleteActivities", 2)
+}
+
+func TestActivityService_Backfill(t *testing.T) {
+	ctx := context.Background()
+	mockClient := new(MockStravaClient)
+	mockClient.On("GetAthleteActivities", 1, DefaultPageSize, int64(200), int64(100)).
+		Return(historyPage(1, DefaultPageSize, "Morning Run"), nil)
+	mockClient.On("GetAthleteActivities", 2, DefaultPageSize, int64(200), int64(100)).
+		Return(append(historyPage(1001, 1, "Evening Ride"), historyPage(1002, 1, "Hill repeats")...), nil)
+	mockClient.On("UpdateActivity", mock.AnythingOfType("int64"), mock.AnythingOfType("string")).Return(nil)
+
+	s := NewActivityService(mockClient)
+	cursor := &BackfillCursor{Before: 200, After: 100, NextPage: 1}
+	var saved []BackfillCursor
+	checkpoint := func(ctx context.Context, c *BackfillCursor) error {
+		saved = append(saved, *c)
+		return nil
+	}
+
+	// One page per run, resuming from the cursor
+	require.NoError(t, s.Backfill(ctx, cursor, 1, checkpoint))
+	assert.Equal(t, BackfillCursor{Before: 200, After: 100, NextPage: 2, Scanned: DefaultPageSize, Renamed: DefaultPageSize}, *cursor)
+
+	require.NoError(t, s.Backfill(ctx, cursor, 1, checkpoint))
+	assert.Equal(t, 3, cursor.NextPage)
+	assert.Equal(t, DefaultPageSize+2, cursor.Scanned)
+	assert.Equal(t, DefaultPageSize+1, cursor.Renamed)
+	assert.True(t, cursor.Done)
+
+	// A finished backfill does nothing
+	require.NoError(t, s.Backfill(ctx, cursor, 1, checkpoint))
+	assert.Len(t, saved, 2)
+	mockClient.AssertNumberOfCalls(t, "GetAthleteActivities", 2)
+	mockClient.AssertNotCalled(t, "UpdateActivity", int64(1002), mock.Anything)
+}
+
+func TestActivityService_BackfillStopsWhenRateLimited(t *testing.T) {
+	ctx := context.Background()
+	limited := &strava.RateLimitError{RetryAfter: time.Now().Add(time.Minute)}
+	mockClient := new(MockStravaClient)
+	mockClient.On("GetAthleteActivities", 1, DefaultPageSize, int64(0), int64(0)).
+		Return(historyPage(1, 2, "Morning Run"), nil)
+	mockClient.On("UpdateActivity", int64(1), mock.AnythingOfType("string")).Return(nil)
+	mockClient.On("UpdateActivity", int64(2), mock.AnythingOfType("string")).
+		Return(fmt.Errorf("failed to update activity: %w", limited))
+
+	cursor := &BackfillCursor{NextPage: 1}
+	checkpointed := false
+	err := NewActivityService(mockClient).Backfill(ctx, cursor, 0, func(context.Context, *BackfillCursor) error {
+		checkpointed = true
+		return nil
+	})
+
+	assert.ErrorIs(t, err, strava.ErrRateLimited)
+	// The page is scanned again on resume
+	assert.False(t, checkpointed)
+	assert.Equal(t, 1, cursor.NextPage)
+	assert.Equal(t, 0, cursor.Scanned)
+}
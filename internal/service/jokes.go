@@ -1,6 +1,10 @@
 package service
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/guisithos/go-ride-names/internal/defaultnames"
+)
 
 // Define activity types based on Strava sport_type
 const (
@@ -35,14 +39,15 @@ const (
 // Update the activity type detection
 func getActivityType(activityName string, sportType string) string {
 	// First try to match by sport_type if available
-	switch sportType {
-	case Run, Ride, Swim, Walk, Workout, WeightTraining, Yoga,
-		Hike, TrailRun, VirtualRide, VirtualRun, Elliptical,
-		StairStepper, Crossfit, Pilates, Skateboard, Surf,
-		Soccer, Squash, MountainBikeRide, Canoeing:
+	if hasJokes(sportType) {
 		return sportType
 	}
 
+	// Then by the sport a default title names, in any language
+	if match, ok := defaultnames.Detect(activityName); ok && hasJokes(match.SportType) {
+		return match.SportType
+	}
+
 	// Fallback to name-based detection for backward compatibility
 	switch {
 	case strings.Contains(activityName, "Run"):
@@ -62,6 +67,18 @@ func getActivityType(activityName string, sportType string) string {
 	}
 }
 
+// hasJokes reports whether there are jokes for the activity type
+func hasJokes(activityType string) bool {
+	switch activityType {
+	case Run, Ride, Swim, Walk, Workout, WeightTraining, Yoga,
+		Hike, TrailRun, VirtualRide, VirtualRun, Elliptical,
+		StairStepper, Crossfit, Pilates, Skateboard, Surf,
+		Soccer, Squash, MountainBikeRide, Canoeing:
+		return true
+	}
+	return false
+}
+
 var activityJokes = map[string][]string{
 	Run: {
 		"🏃‍♂️ 'Minha corrida é como meu código: cheia de loops infinitos e erros inesperados.'",
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math/rand"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+)
+
+// RenameProposal is a rename the athlete can review before it is written to
+// Strava
+type RenameProposal struct {
+	ActivityID int64  `json:"activity_id"`
+	OldName    string `json:"old_name"`
+	NewName    string `json:"new_name"`
+	JokeID     string `json:"joke_id"`
+	Type       string `json:"type"`
+}
+
+// PlanRenames proposes a fun name for every default-named activity without
+// changing anything on Strava. Activities whose rename the athlete undid, or
+// that cannot be checked, are left out.
+func (s *ActivityService) PlanRenames(ctx context.Context, activities []strava.Activity) []RenameProposal {
+	proposals := []RenameProposal{}
+	for _, activity := range activities {
+		if !isDefaultName(activity.Name) {
+			continue
+		}
+		undone, err := s.wasUndone(ctx, activity.ID)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		if undone {
+			continue
+		}
+		activityType := getActivityType(activity.Name, activity.SportType)
+		name, id := getRandomJoke(activityType)
+		proposals = append(proposals, RenameProposal{
+			ActivityID: activity.ID,
+			OldName:    activity.Name,
+			NewName:    name,
+			JokeID:     id,
+			Type:       activityType,
+		})
+	}
+	return proposals
+}
+
+// Reroll proposes a different name of the same type
+func Reroll(proposal RenameProposal) RenameProposal {
+	jokeType := proposal.Type
+	jokes, exists := activityJokes[jokeType]
+	if !exists || len(jokes) == 0 {
+		jokeType = Default
+		jokes = activityJokes[Default]
+	}
+	if len(jokes) < 2 {
+		return proposal
+	}
+
+	for {
+		i := rand.Intn(len(jokes))
+		if jokes[i] != proposal.NewName {
+			proposal.NewName = jokes[i]
+			proposal.JokeID = jokeID(jokeType, i)
+			return proposal
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityService_PlanRenames(t *testing.T) {
+	mockClient := new(MockStravaClient)
+	s := NewActivityService(mockClient)
+
+	proposals := s.PlanRenames(context.Background(), []strava.Activity{
+		{ID: 1, Name: "Morning Run", SportType: "Run"},
+		{ID: 2, Name: "Epic Trail Run", SportType: "Run"},
+		{ID: 3, Name: "Evening Yoga", SportType: "Yoga"},
+	})
+
+	require.Len(t, proposals, 2)
+	assert.Equal(t, int64(1), proposals[0].ActivityID)
+	assert.Equal(t, "Morning Run", proposals[0].OldName)
+	assert.Equal(t, Run, proposals[0].Type)
+	assert.Contains(t, activityJokes[Run], proposals[0].NewName)
+	assert.Equal(t, Yoga, proposals[1].Type)
+	mockClient.AssertNotCalled(t, "UpdateActivity", mock.Anything, mock.Anything)
+
+	assert.NotNil(t, s.PlanRenames(context.Background(), nil), "an empty plan encodes as []")
+}
+
+func TestReroll(t *testing.T) {
+	proposal := RenameProposal{ActivityID: 1, OldName: "Morning Swim", NewName: activityJokes[Swim][0], Type: Swim}
+	for i := 0; i < 20; i++ {
+		rerolled := Reroll(proposal)
+		assert.NotEqual(t, proposal.NewName, rerolled.NewName)
+		assert.Contains(t, activityJokes[Swim], rerolled.NewName)
+		assert.Equal(t, proposal.ActivityID, rerolled.ActivityID)
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+)
+
+// Reasons an activity was skipped or failed to be renamed
+const (
+	ReasonNotDefaultName = "not_default_name"
+	ReasonNotSelected    = "not_selected"
+	ReasonNameChanged    = "name_changed"
+	ReasonAlreadyUndone  = "already_undone"
+	ReasonUndone         = "undone"
+	ReasonRateLimited    = "rate_limited"
+	ReasonNotFound       = "not_found"
+	ReasonUnauthorized   = "unauthorized"
+	ReasonStravaError    = "strava_error"
+	ReasonTimeout        = "timeout"
+	ReasonError          = "error"
+)
+
+// RenameOutcome is what happened to one activity
+type RenameOutcome struct {
+	ActivityID int64  `json:"activity_id"`
+	OldName    string `json:"old_name"`
+	NewName    string `json:"new_name,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// RenameReport tells which activities were renamed, which were skipped and
+// which failed, and why. An undo reports the restored names as renamed.
+type RenameReport struct {
+	Renamed []RenameOutcome `json:"renamed"`
+	Skipped []RenameOutcome `json:"skipped"`
+	Failed  []RenameOutcome `json:"failed"`
+}
+
+// NewRenameReport returns an empty report
+func NewRenameReport() *RenameReport {
+	return &RenameReport{
+		Renamed: []RenameOutcome{},
+		Skipped: []RenameOutcome{},
+		Failed:  []RenameOutcome{},
+	}
+}
+
+// failureReason classifies a rename error for the report
+func failureReason(err error) string {
+	var apiErr *strava.APIError
+	switch {
+	case errors.Is(err, strava.ErrRateLimited):
+		return ReasonRateLimited
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return ReasonTimeout
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		return ReasonNotFound
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden):
+		return ReasonUnauthorized
+	case errors.As(err, &apiErr):
+		return ReasonStravaError
+	}
+	return ReasonError
+}
+
+// RenameActivities gives a fun name to every default-named activity and
+// reports what happened to each one. Activity names are updated in place.
+// Activities whose rename the athlete undid are skipped.
+//
+// When Strava's rate limit is reached the remaining activities are reported
+// as failed and the error is returned along with the report.
+func (s *ActivityService) RenameActivities(ctx context.Context, activities []strava.Activity) (*RenameReport, error) {
+	report := NewRenameReport()
+	for i := range activities {
+		activity := &activities[i]
+		if !isDefaultName(activity.Name) {
+			report.Skipped = append(report.Skipped, RenameOutcome{ActivityID: activity.ID, OldName: activity.Name, Reason: ReasonNotDefaultName})
+			continue
+		}
+		undone, err := s.wasUndone(ctx, activity.ID)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			report.Failed = append(report.Failed, RenameOutcome{ActivityID: activity.ID, OldName: activity.Name, Reason: ReasonError})
+			continue
+		}
+		if undone {
+			report.Skipped = append(report.Skipped, RenameOutcome{ActivityID: activity.ID, OldName: activity.Name, Reason: ReasonUndone})
+			continue
+		}
+
+		oldName := activity.Name
+		if err := s.UpdateActivityWithFunName(ctx, activity); err != nil {
+			reason := failureReason(err)
+			report.Failed = append(report.Failed, RenameOutcome{ActivityID: activity.ID, OldName: oldName, Reason: reason})
+
+			// Every further update would be refused as well
+			if errors.Is(err, strava.ErrRateLimited) || ctx.Err() != nil {
+				for _, rest := range activities[i+1:] {
+					if isDefaultName(rest.Name) {
+						report.Failed = append(report.Failed, RenameOutcome{ActivityID: rest.ID, OldName: rest.Name, Reason: reason})
+					}
+				}
+				return report, err
+			}
+			log.Printf("Warning: failed to update activity %d: %v", activity.ID, err)
+			continue
+		}
+		report.Renamed = append(report.Renamed, RenameOutcome{ActivityID: activity.ID, OldName: oldName, NewName: activity.Name})
+	}
+	return report, nil
+}
+
+// RenamePages renames the default-named activities on every page the pager
+// returns and reports on all of them. It stops at the first error, such as
+// Strava's rate limit, returning the report so far.
+func (s *ActivityService) RenamePages(ctx context.Context, pager *ActivityPager) (*RenameReport, error) {
+	report := NewRenameReport()
+	for !pager.Done() {
+		activities, err := pager.Next(ctx)
+		if err != nil {
+			return report, err
+		}
+
+		page, err := s.RenameActivities(ctx, activities)
+		report.Renamed = append(report.Renamed, page.Renamed...)
+		report.Skipped = append(report.Skipped, page.Skipped...)
+		report.Failed = append(report.Failed, page.Failed...)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// ApplyRenames writes the proposed names to Strava and reports the outcome of
+// each proposal. An activity whose name changed since the proposal was made
+// is skipped, so a title the athlete typed meanwhile is kept. Like
+// RenameActivities it stops at Strava's rate limit.
+func (s *ActivityService) ApplyRenames(ctx context.Context, proposals []RenameProposal) (*RenameReport, error) {
+	report := NewRenameReport()
+	for i, proposal := range proposals {
+		err := s.renameFrom(ctx, proposal.ActivityID, proposal.OldName, proposal.NewName)
+		if errors.Is(err, ErrNameChanged) {
+			report.Skipped = append(report.Skipped, RenameOutcome{ActivityID: proposal.ActivityID, OldName: proposal.OldName, Reason: ReasonNameChanged})
+			continue
+		}
+		if err != nil {
+			reason := failureReason(err)
+			report.Failed = append(report.Failed, RenameOutcome{ActivityID: proposal.ActivityID, OldName: proposal.OldName, Reason: reason})
+
+			if errors.Is(err, strava.ErrRateLimited) || ctx.Err() != nil {
+				for _, rest := range proposals[i+1:] {
+					report.Failed = append(report.Failed, RenameOutcome{ActivityID: rest.ActivityID, OldName: rest.OldName, Reason: reason})
+				}
+				return report, fmt.Errorf("error updating activity %d: %w", proposal.ActivityID, err)
+			}
+			log.Printf("Warning: failed to update activity %d: %v", proposal.ActivityID, err)
+			continue
+		}
+		s.renamed(ctx, Rename{ActivityID: proposal.ActivityID, OldName: proposal.OldName, NewName: proposal.NewName, JokeID: proposal.JokeID})
+		report.Renamed = append(report.Renamed, RenameOutcome{ActivityID: proposal.ActivityID, OldName: proposal.OldName, NewName: proposal.NewName})
+	}
+	return report, nil
+}
+
+// Restore is an activity to give back the name it had before we renamed it
+type Restore struct {
+	ActivityID int64
+	RenamedTo  string
+	Original   string
+}
+
+// RestoreNames puts back the original names and reports the outcome of each
+// restore. An activity the athlete renamed since is skipped. Like
+// ApplyRenames it stops at Strava's rate limit.
+func (s *ActivityService) RestoreNames(ctx context.Context, restores []Restore) (*RenameReport, error) {
+	report := NewRenameReport()
+	for i, restore := range restores {
+		err := s.RestoreName(ctx, restore.ActivityID, restore.RenamedTo, restore.Original)
+		if errors.Is(err, ErrNameChanged) {
+			report.Skipped = append(report.Skipped, RenameOutcome{ActivityID: restore.ActivityID, OldName: restore.RenamedTo, Reason: ReasonNameChanged})
+			continue
+		}
+		if err != nil {
+			reason := failureReason(err)
+			report.Failed = append(report.Failed, RenameOutcome{ActivityID: restore.ActivityID, OldName: restore.RenamedTo, Reason: reason})
+
+			if errors.Is(err, strava.ErrRateLimited) || ctx.Err() != nil {
+				for _, rest := range restores[i+1:] {
+					report.Failed = append(report.Failed, RenameOutcome{ActivityID: rest.ActivityID, OldName: rest.RenamedTo, Reason: reason})
+				}
+				return report, fmt.Errorf("error restoring activity %d: %w", restore.ActivityID, err)
+			}
+			log.Printf("Warning: failed to restore name of activity %d: %v", restore.ActivityID, err)
+			continue
+		}
+		report.Renamed = append(report.Renamed, RenameOutcome{ActivityID: restore.ActivityID, OldName: restore.RenamedTo, NewName: restore.Original})
+	}
+	return report, nil
+}
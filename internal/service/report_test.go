@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityService_RenameActivities(t *testing.T) {
+	ctx := context.Background()
+	mockClient := new(MockStravaClient)
+	mockClient.On("UpdateActivity", int64(1), mock.AnythingOfType("string")).Return(nil)
+	mockClient.On("UpdateActivity", int64(3), mock.AnythingOfType("string")).
+		Return(fmt.Errorf("failed to update activity: %w", &strava.APIError{StatusCode: http.StatusNotFound}))
+
+	activities := []strava.Activity{
+		{ID: 1, Name: "Morning Run", SportType: "Run"},
+		{ID: 2, Name: "Epic Trail Run", SportType: "Run"},
+		{ID: 3, Name: "Evening Ride", SportType: "Ride"},
+	}
+	report, err := NewActivityService(mockClient).RenameActivities(ctx, activities)
+	require.NoError(t, err)
+
+	require.Len(t, report.Renamed, 1)
+	assert.Equal(t, RenameOutcome{ActivityID: 1, OldName: "Morning Run", NewName: activities[0].Name}, report.Renamed[0])
+	assert.Equal(t, []RenameOutcome{{ActivityID: 2, OldName: "Epic Trail Run", Reason: ReasonNotDefaultName}}, report.Skipped)
+	assert.Equal(t, []RenameOutcome{{ActivityID: 3, OldName: "Evening Ride", Reason: ReasonNotFound}}, report.Failed)
+}
+
+func TestActivityService_RenameActivitiesRateLimited(t *testing.T) {
+	ctx := context.Background()
+	limited := &strava.RateLimitError{RetryAfter: time.Now().Add(time.Minute)}
+	mockClient := new(MockStravaClient)
+	mockClient.On("UpdateActivity", int64(1), mock.AnythingOfType("string")).
+		Return(fmt.Errorf("failed to update activity: %w", limited))
+
+	report, err := NewActivityService(mockClient).RenameActivities(ctx, []strava.Activity{
+		{ID: 1, Name: "Morning Run", SportType: "Run"},
+		{ID: 2, Name: "Hill repeats", SportType: "Run"},
+		{ID: 3, Name: "Night Walk", SportType: "Walk"},
+	})
+
+	assert.ErrorIs(t, err, strava.ErrRateLimited)
+	assert.Empty(t, report.Renamed)
+	assert.Equal(t, []RenameOutcome{
+		{ActivityID: 1, OldName: "Morning Run", Reason: ReasonRateLimited},
+		{ActivityID: 3, OldName: "Night Walk", Reason: ReasonRateLimited},
+	}, report.Failed)
+	mockClient.AssertNumberOfCalls(t, "UpdateActivity", 1)
+}
+
+func TestActivityService_RenamePages(t *testing.T) {
+	ctx := context.Background()
+	limited := &strava.RateLimitError{RetryAfter: time.Now().Add(time.Minute)}
+	mockClient := new(MockStravaClient)
+	mockClient.On("GetAthleteActivities", 1, 2, int64(0), int64(100)).Return(historyPage(1, 2, "Morning Run"), nil)
+	mockClient.On("GetAthleteActivities", 2, 2, int64(0), int64(100)).
+		Return(append(historyPage(3, 1, "Hill repeats"), historyPage(4, 1, "Night Walk")...), nil)
+	mockClient.On("UpdateActivity", int64(1), mock.AnythingOfType("string")).Return(nil)
+	mockClient.On("UpdateActivity", int64(2), mock.AnythingOfType("string")).Return(nil)
+	mockClient.On("UpdateActivity", int64(4), mock.AnythingOfType("string")).Return(limited)
+
+	s := NewActivityService(mockClient)
+	report, err := s.RenamePages(ctx, s.Pager(0, 100, 2, 1))
+
+	// The rate limit stops the walk; the third page is never fetched
+	assert.ErrorIs(t, err, strava.ErrRateLimited)
+	assert.Len(t, report.Renamed, 2)
+	assert.Equal(t, []RenameOutcome{{ActivityID: 3, OldName: "Hill repeats", Reason: ReasonNotDefaultName}}, report.Skipped)
+	assert.Equal(t, []RenameOutcome{{ActivityID: 4, OldName: "Night Walk", Reason: ReasonRateLimited}}, report.Failed)
+	mockClient.AssertNumberOfCalls(t, "GetAthleteActivities", 2)
+}
+
+func TestActivityService_ApplyRenames(t *testing.T) {
+	ctx := context.Background()
+	proposals := []RenameProposal{
+		{ActivityID: 1, OldName: "Morning Run", NewName: "one"},
+		{ActivityID: 2, OldName: "Lunch Run", NewName: "two"},
+		{ActivityID: 3, OldName: "Night Run", NewName: "three"},
+	}
+
+	// current serves the activities with the names the proposals were made for
+	current := func(mockClient *MockStravaClient) {
+		for _, proposal := range proposals {
+			mockClient.On("GetActivity", proposal.ActivityID).Return(&strava.Activity{ID: proposal.ActivityID, Name: proposal.OldName}, nil)
+		}
+	}
+
+	t.Run("reports failed renames", func(t *testing.T) {
+		mockClient := new(MockStravaClient)
+		current(mockClient)
+		mockClient.On("UpdateActivity", int64(1), "one").Return(nil)
+		mockClient.On("UpdateActivity", int64(2), "two").Return(assert.AnError)
+		mockClient.On("UpdateActivity", int64(3), "three").Return(nil)
+
+		report, err := NewActivityService(mockClient).ApplyRenames(ctx, proposals)
+		require.NoError(t, err)
+		assert.Equal(t, []RenameOutcome{
+			{ActivityID: 1, OldName: "Morning Run", NewName: "one"},
+			{ActivityID: 3, OldName: "Night Run", NewName: "three"},
+		}, report.Renamed)
+		assert.Equal(t, []RenameOutcome{{ActivityID: 2, OldName: "Lunch Run", Reason: ReasonError}}, report.Failed)
+	})
+
+	t.Run("stops at the rate limit", func(t *testing.T) {
+		limited := &strava.RateLimitError{RetryAfter: time.Now().Add(time.Minute)}
+		mockClient := new(MockStravaClient)
+		current(mockClient)
+		mockClient.On("UpdateActivity", int64(1), "one").Return(nil)
+		mockClient.On("UpdateActivity", int64(2), "two").Return(fmt.Errorf("failed to update activity: %w", limited))
+
+		report, err := NewActivityService(mockClient).ApplyRenames(ctx, proposals)
+		assert.ErrorIs(t, err, strava.ErrRateLimited)
+		assert.Len(t, report.Renamed, 1)
+		assert.Len(t, report.Failed, 2)
+		mockClient.AssertNotCalled(t, "UpdateActivity", int64(3), "three")
+	})
+
+	t.Run("skips activities renamed since the preview", func(t *testing.T) {
+		var renamed []Rename
+		mockClient := new(MockStravaClient)
+		mockClient.On("GetActivity", int64(1)).Return(&strava.Activity{ID: 1, Name: "Tempo with the club"}, nil)
+		mockClient.On("GetActivity", int64(2)).Return(&strava.Activity{ID: 2, Name: "Lunch Run"}, nil)
+		mockClient.On("GetActivity", int64(3)).Return(nil, &strava.APIError{StatusCode: http.StatusNotFound})
+		mockClient.On("UpdateActivity", int64(2), "two").Return(nil)
+
+		s := NewActivityService(mockClient)
+		s.OnRename(func(ctx context.Context, r Rename) { renamed = append(renamed, r) })
+		report, err := s.ApplyRenames(ctx, proposals)
+		require.NoError(t, err)
+
+		assert.Equal(t, []RenameOutcome{{ActivityID: 2, OldName: "Lunch Run", NewName: "two"}}, report.Renamed)
+		assert.Equal(t, []RenameOutcome{{ActivityID: 1, OldName: "Morning Run", Reason: ReasonNameChanged}}, report.Skipped)
+		assert.Equal(t, []RenameOutcome{{ActivityID: 3, OldName: "Night Run", Reason: ReasonNotFound}}, report.Failed)
+		assert.Len(t, renamed, 1)
+		mockClient.AssertNotCalled(t, "UpdateActivity", int64(1), "one")
+	})
+}
+
+func TestActivityService_RestoreNames(t *testing.T) {
+	ctx := context.Background()
+	limited := &strava.RateLimitError{RetryAfter: time.Now().Add(time.Minute)}
+	mockClient := new(MockStravaClient)
+	mockClient.On("GetActivity", int64(1)).Return(&strava.Activity{ID: 1, Name: "one"}, nil)
+	mockClient.On("GetActivity", int64(2)).Return(&strava.Activity{ID: 2, Name: "Tempo with the club"}, nil)
+	mockClient.On("GetActivity", int64(3)).Return(&strava.Activity{ID: 3, Name: "three"}, nil)
+	mockClient.On("UpdateActivity", int64(1), "Morning Run").Return(nil)
+	mockClient.On("UpdateActivity", int64(3), "Night Run").Return(fmt.Errorf("failed to update activity: %w", limited))
+
+	report, err := NewActivityService(mockClient).RestoreNames(ctx, []Restore{
+		{ActivityID: 1, RenamedTo: "one", Original: "Morning Run"},
+		{ActivityID: 2, RenamedTo: "two", Original: "Lunch Run"},
+		{ActivityID: 3, RenamedTo: "three", Original: "Night Run"},
+		{ActivityID: 4, RenamedTo: "four", Original: "Evening Run"},
+	})
+
+	assert.ErrorIs(t, err, strava.ErrRateLimited)
+	assert.Equal(t, []RenameOutcome{{ActivityID: 1, OldName: "one", NewName: "Morning Run"}}, report.Renamed)
+	assert.Equal(t, []RenameOutcome{{ActivityID: 2, OldName: "two", Reason: ReasonNameChanged}}, report.Skipped)
+	assert.Equal(t, []RenameOutcome{
+		{ActivityID: 3, OldName: "three", Reason: ReasonRateLimited},
+		{ActivityID: 4, OldName: "four", Reason: ReasonRateLimited},
+	}, report.Failed)
+	mockClient.AssertNotCalled(t, "GetActivity", int64(4))
+}
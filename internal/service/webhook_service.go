@@ -1,63 +1,176 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/guisithos/go-ride-names/internal/strava"
 )
 
+// Reconcile actions
+const (
+	SubscriptionUnchanged = "unchanged"
+	SubscriptionCreated   = "created"
+	SubscriptionReplaced  = "replaced"
+)
+
+// SubscriptionStatus is the outcome of the last reconciliation
+type SubscriptionStatus struct {
+	CheckedAt    time.Time                   `json:"checked_at"`
+	Action       string                      `json:"action,omitempty"`
+	Subscription *strava.WebhookSubscription `json:"subscription,omitempty"`
+	Error        string                      `json:"error,omitempty"`
+}
+
+// WebhookService manages the app's Strava push subscription. Strava allows a
+// single subscription per application, delivering events for every athlete,
+// so it is managed once for the app and never per user.
 type WebhookService struct {
-	client *strava.Client
+	client      strava.WebhookSubscriptionClient
+	callbackURL string
+	verifyToken string
+
+	mu          sync.Mutex
+	last        *SubscriptionStatus
+	refreshedAt time.Time
 }
 
-func NewWebhookService(client *strava.Client) *WebhookService {
+// subscriptionRefreshInterval is how often Refresh may ask Strava. Anyone can
+// post to the webhook endpoint, so unknown subscription IDs must not spend
+// the app's rate limit.
+const subscriptionRefreshInterval = 30 * time.Second
+
+func NewWebhookService(client strava.WebhookSubscriptionClient, callbackURL, verifyToken string) *WebhookService {
 	return &WebhookService{
-		client: client,
+		client:      client,
+		callbackURL: callbackURL,
+		verifyToken: verifyToken,
 	}
 }
 
-func (s *WebhookService) SubscribeToWebhooks(callbackURL, verifyToken string) error {
-	log.Printf("Starting webhook subscription process for URL: %s", callbackURL)
+// Reconcile makes sure the app is subscribed with our callback URL. An
+// existing subscription for the same URL is kept, one pointing elsewhere is
+// replaced and a missing one is created. The outcome is kept for LastStatus.
+func (s *WebhookService) Reconcile(ctx context.Context) (*SubscriptionStatus, error) {
+	status := &SubscriptionStatus{CheckedAt: time.Now().UTC()}
+
+	sub, action, err := s.reconcile(ctx)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Action = action
+		status.Subscription = sub
+		log.Printf("Webhook subscription %d %s for URL: %s", sub.ID, action, sub.CallbackURL)
+	}
+
+	s.mu.Lock()
+	s.last = status
+	s.mu.Unlock()
+
+	return status, err
+}
+
+func (s *WebhookService) reconcile(ctx context.Context) (*strava.WebhookSubscription, string, error) {
+	if s.verifyToken == "" {
+		return nil, "", fmt.Errorf("webhook verify token not configured")
+	}
+
+	log.Printf("Reconciling webhook subscription for URL: %s", s.callbackURL)
+
+	subscriptions, err := s.client.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing subscriptions: %w", err)
+	}
+
+	for _, sub := range subscriptions {
+		if sub.CallbackURL == s.callbackURL {
+			return &sub, SubscriptionUnchanged, nil
+		}
+	}
 
-	if err := s.cleanupExistingSubscriptions(); err != nil {
-		return fmt.Errorf("cleanup failed: %v", err)
+	action := SubscriptionCreated
+	for _, sub := range subscriptions {
+		log.Printf("Deleting subscription %d with stale URL: %s", sub.ID, sub.CallbackURL)
+		if err := s.client.DeleteWebhookSubscription(ctx, sub.ID); err != nil {
+			return nil, "", fmt.Errorf("error deleting subscription %d: %w", sub.ID, err)
+		}
+		action = SubscriptionReplaced
 	}
 
-	subscription, err := s.client.CreateWebhookSubscription(callbackURL, verifyToken)
+	subscription, err := s.client.CreateWebhookSubscription(ctx, s.callbackURL, s.verifyToken)
 	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
+		var apiErr *strava.APIError
+		if errors.As(err, &apiErr) && apiErr.HasCode("already exists") {
 			log.Printf("Subscription already exists")
-			return nil
+			sub, err := s.GetSubscription(ctx)
+			if err != nil {
+				return nil, "", err
+			}
+			if sub == nil {
+				return nil, "", fmt.Errorf("subscription reported as existing but not listed")
+			}
+			return sub, SubscriptionUnchanged, nil
 		}
-		return fmt.Errorf("failed to create subscription: %v", err)
+		return nil, "", fmt.Errorf("failed to create subscription: %w", err)
 	}
 
-	log.Printf("Successfully created webhook subscription: ID=%d", subscription.ID)
-	return nil
+	return subscription, action, nil
 }
 
-func (s *WebhookService) cleanupExistingSubscriptions() error {
-	subscriptions, err := s.client.ListWebhookSubscriptions()
+// LastStatus returns the outcome of the last Reconcile, or nil if it has not
+// run yet
+func (s *WebhookService) LastStatus() *SubscriptionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Refresh looks up the app's subscription on Strava, without changing it, and
+// keeps it for LastStatus. This picks up a subscription another instance or
+// the admin CLI created after our Reconcile. Strava is asked at most once per
+// subscriptionRefreshInterval; in between the last status is returned.
+func (s *WebhookService) Refresh(ctx context.Context) (*SubscriptionStatus, error) {
+	s.mu.Lock()
+	if time.Since(s.refreshedAt) < subscriptionRefreshInterval {
+		defer s.mu.Unlock()
+		return s.last, nil
+	}
+	s.refreshedAt = time.Now()
+	s.mu.Unlock()
+
+	subscriptions, err := s.client.ListWebhookSubscriptions(ctx)
 	if err != nil {
-		return fmt.Errorf("error listing subscriptions: %v", err)
+		return nil, fmt.Errorf("error listing subscriptions: %w", err)
 	}
 
-	for _, sub := range subscriptions {
-		if err := s.client.DeleteWebhookSubscription(sub.ID); err != nil {
-			log.Printf("Warning: failed to delete subscription %d: %v", sub.ID, err)
+	status := &SubscriptionStatus{CheckedAt: time.Now().UTC()}
+	for i := range subscriptions {
+		if subscriptions[i].CallbackURL == s.callbackURL {
+			status.Action = SubscriptionUnchanged
+			status.Subscription = &subscriptions[i]
+			break
 		}
-		time.Sleep(100 * time.Millisecond)
 	}
-	return nil
+	if status.Subscription == nil {
+		status.Error = fmt.Sprintf("no subscription for URL: %s", s.callbackURL)
+	}
+
+	s.mu.Lock()
+	s.last = status
+	s.mu.Unlock()
+	return status, nil
 }
 
-func (s *WebhookService) GetSubscriptionStatus() (bool, error) {
-	subscriptions, err := s.client.ListWebhookSubscriptions()
+// GetSubscription returns the app's current subscription, or nil if there is
+// none.
+func (s *WebhookService) GetSubscription(ctx context.Context) (*strava.WebhookSubscription, error) {
+	subscriptions, err := s.client.ListWebhookSubscriptions(ctx)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	// Log subscription details
@@ -66,19 +179,24 @@ func (s *WebhookService) GetSubscriptionStatus() (bool, error) {
 			sub.ID, sub.CallbackURL)
 	}
 
-	return len(subscriptions) > 0, nil
+	if len(subscriptions) == 0 {
+		return nil, nil
+	}
+	return &subscriptions[0], nil
 }
 
-func (s *WebhookService) UnsubscribeFromWebhooks() error {
-	subscriptions, err := s.client.ListWebhookSubscriptions()
+// UnsubscribeFromWebhooks deletes the app's subscriptions, turning off
+// auto-rename for every athlete.
+func (s *WebhookService) UnsubscribeFromWebhooks(ctx context.Context) error {
+	subscriptions, err := s.client.ListWebhookSubscriptions(ctx)
 	if err != nil {
-		return fmt.Errorf("error listing subscriptions: %v", err)
+		return fmt.Errorf("error listing subscriptions: %w", err)
 	}
 
 	for _, sub := range subscriptions {
 		log.Printf("Deleting subscription ID: %d", sub.ID)
-		if err := s.client.DeleteWebhookSubscription(sub.ID); err != nil {
-			return fmt.Errorf("error deleting subscription %d: %v", sub.ID, err)
+		if err := s.client.DeleteWebhookSubscription(ctx, sub.ID); err != nil {
+			return fmt.Errorf("error deleting subscription %d: %w", sub.ID, err)
 		}
 	}
 
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testCallbackURL = "https://example.com/webhook"
+
+// MockSubscriptionClient is a mock implementation of the push subscription API
+type MockSubscriptionClient struct {
+	mock.Mock
+}
+
+func (m *MockSubscriptionClient) ListWebhookSubscriptions(ctx context.Context) ([]strava.WebhookSubscription, error) {
+	args := m.Called()
+	return args.Get(0).([]strava.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockSubscriptionClient) CreateWebhookSubscription(ctx context.Context, callbackURL, verifyToken string) (*strava.WebhookSubscription, error) {
+	args := m.Called(callbackURL, verifyToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*strava.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockSubscriptionClient) DeleteWebhookSubscription(ctx context.Context, subscriptionID int64) error {
+	args := m.Called(subscriptionID)
+	return args.Error(0)
+}
+
+func TestWebhookService_Reconcile(t *testing.T) {
+	tests := []struct {
+		name           string
+		existing       []strava.WebhookSubscription
+		expectedAction string
+		expectDelete   []int64
+		expectCreate   bool
+	}{
+		{
+			name:           "no subscription",
+			existing:       []strava.WebhookSubscription{},
+			expectedAction: SubscriptionCreated,
+			expectCreate:   true,
+		},
+		{
+			name:           "matching subscription",
+			existing:       []strava.WebhookSubscription{{ID: 1, CallbackURL: testCallbackURL}},
+			expectedAction: SubscriptionUnchanged,
+		},
+		{
+			name:           "stale callback URL",
+			existing:       []strava.WebhookSubscription{{ID: 1, CallbackURL: "https://old.example.com/webhook"}},
+			expectedAction: SubscriptionReplaced,
+			expectDelete:   []int64{1},
+			expectCreate:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := new(MockSubscriptionClient)
+			client.On("ListWebhookSubscriptions").Return(tt.existing, nil)
+			for _, id := range tt.expectDelete {
+				client.On("DeleteWebhookSubscription", id).Return(nil)
+			}
+			if tt.expectCreate {
+				client.On("CreateWebhookSubscription", testCallbackURL, "verify").
+					Return(&strava.WebhookSubscription{ID: 2, CallbackURL: testCallbackURL}, nil)
+			}
+
+			service := NewWebhookService(client, testCallbackURL, "verify")
+			assert.Nil(t, service.LastStatus())
+
+			status, err := service.Reconcile(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedAction, status.Action)
+			assert.Equal(t, testCallbackURL, status.Subscription.CallbackURL)
+			assert.Equal(t, status, service.LastStatus())
+
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWebhookService_ReconcileAlreadyExists(t *testing.T) {
+	// Another instance created the subscription between our list and create
+	client := new(MockSubscriptionClient)
+	client.On("ListWebhookSubscriptions").Return([]strava.WebhookSubscription{}, nil).Once()
+	client.On("ListWebhookSubscriptions").Return([]strava.WebhookSubscription{{ID: 5, CallbackURL: testCallbackURL}}, nil)
+	client.On("CreateWebhookSubscription", testCallbackURL, "verify").Return(nil, fmt.Errorf("failed to create subscription: %w", &strava.APIError{
+		StatusCode: 400,
+		Message:    "Bad Request",
+		Errors:     []strava.ErrorDetail{{Resource: "PushSubscription", Field: "", Code: "already exists"}},
+	}))
+
+	service := NewWebhookService(client, testCallbackURL, "verify")
+	status, err := service.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, SubscriptionUnchanged, status.Action)
+	assert.Equal(t, int64(5), status.Subscription.ID)
+	client.AssertExpectations(t)
+}
+
+func TestWebhookService_ReconcileErrors(t *testing.T) {
+	t.Run("missing verify token", func(t *testing.T) {
+		client := new(MockSubscriptionClient)
+		service := NewWebhookService(client, testCallbackURL, "")
+
+		_, err := service.Reconcile(context.Background())
+		assert.Error(t, err)
+		client.AssertNotCalled(t, "ListWebhookSubscriptions")
+	})
+
+	t.Run("strava failure is recorded", func(t *testing.T) {
+		client := new(MockSubscriptionClient)
+		client.On("ListWebhookSubscriptions").Return([]strava.WebhookSubscription(nil), errors.New("status=503"))
+		service := NewWebhookService(client, testCallbackURL, "verify")
+
+		_, err := service.Reconcile(context.Background())
+		assert.Error(t, err)
+		require.NotNil(t, service.LastStatus())
+		assert.Contains(t, service.LastStatus().Error, "status=503")
+	})
+}
+
+func TestWebhookService_Refresh(t *testing.T) {
+	client := new(MockSubscriptionClient)
+	client.On("ListWebhookSubscriptions").Return([]strava.WebhookSubscription{
+		{ID: 1, CallbackURL: "https://other.example.com/webhook"},
+		{ID: 2, CallbackURL: testCallbackURL},
+	}, nil).Once()
+
+	service := NewWebhookService(client, testCallbackURL, "verify")
+	status, err := service.Refresh(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, status.Subscription)
+	assert.Equal(t, int64(2), status.Subscription.ID)
+	assert.Equal(t, status, service.LastStatus())
+
+	// Strava is not asked again right away
+	again, err := service.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, status, again)
+	client.AssertNumberOfCalls(t, "ListWebhookSubscriptions", 1)
+}
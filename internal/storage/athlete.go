@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// AthleteSettings holds the per-athlete preferences
+type AthleteSettings struct {
+	// AutoRename enables renaming new activities as they arrive via webhook
+	AutoRename bool `json:"auto_rename"`
+}
+
+// athletePrefix is the key prefix holding everything stored for an athlete
+func athletePrefix(athleteID string) string {
+	return fmt.Sprintf("athlete/%s/", athleteID)
+}
+
+func settingsKey(athleteID string) string {
+	return athletePrefix(athleteID) + "settings.json"
+}
+
+// LoadAthleteSettings returns the athlete's settings, or ErrNotFound if they
+// were never saved.
+func LoadAthleteSettings(ctx context.Context, s Store, athleteID string) (*AthleteSettings, error) {
+	var settings AthleteSettings
+	if err := s.Load(ctx, settingsKey(athleteID), &settings); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to load settings for athlete %s: %w", athleteID, err)
+	}
+	return &settings, nil
+}
+
+// SaveAthleteSettings stores the athlete's settings
+func SaveAthleteSettings(ctx context.Context, s Store, athleteID string, settings *AthleteSettings) error {
+	if athleteID == "" {
+		return fmt.Errorf("athlete ID cannot be empty")
+	}
+	return s.Set(ctx, settingsKey(athleteID), settings)
+}
+
+// DeleteAthlete removes every key stored under athlete/<id>/, including tokens,
+// settings and history.
+func DeleteAthlete(ctx context.Context, s Store, athleteID string) error {
+	if athleteID == "" {
+		return fmt.Errorf("athlete ID cannot be empty")
+	}
+
+	keys, err := s.List(ctx, athletePrefix(athleteID))
+	if err != nil {
+		return fmt.Errorf("failed to list data for athlete %s: %v", athleteID, err)
+	}
+
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", key, err)
+		}
+	}
+
+	log.Printf("Deleted %d keys for athlete %s", len(keys), athleteID)
+	return nil
+}
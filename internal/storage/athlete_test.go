@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteAthlete(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	require.NoError(t, store.SaveTokens(ctx, "4", &Tokens{AccessToken: "a", RefreshToken: "r"}))
+	require.NoError(t, store.Set(ctx, "athlete/4/settings.json", map[string]bool{"auto_rename": true}))
+	require.NoError(t, store.Set(ctx, "athlete/4/history/1.json", "entry"))
+	require.NoError(t, store.SaveTokens(ctx, "42", &Tokens{AccessToken: "a", RefreshToken: "r"}))
+
+	require.NoError(t, DeleteAthlete(ctx, store, "4"))
+
+	keys, err := store.List(ctx, "athlete/4/")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	// athlete/42/ shares the "athlete/4" prefix but must be untouched
+	_, err = store.LoadTokens(ctx, "42")
+	assert.NoError(t, err)
+
+	assert.Error(t, DeleteAthlete(ctx, store, ""))
+}
+
+func TestAthleteSettings(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	_, err := LoadAthleteSettings(ctx, store, "4")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, SaveAthleteSettings(ctx, store, "4", &AthleteSettings{AutoRename: true}))
+
+	settings, err := LoadAthleteSettings(ctx, store, "4")
+	require.NoError(t, err)
+	assert.True(t, settings.AutoRename)
+
+	assert.Error(t, SaveAthleteSettings(ctx, store, "", &AthleteSettings{}))
+}
+
+func TestRenameHistory(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	for i, source := range []string{RenameSourceManual, RenameSourceWebhook, RenameSourceBackfill} {
+		require.NoError(t, SaveRename(ctx, store, "4", &RenameRecord{
+			ActivityID:   int64(i + 1),
+			OriginalName: "Morning Run",
+			NewName:      "joke",
+			Source:       source,
+			RenamedAt:    day.AddDate(0, 0, i),
+		}))
+	}
+	require.NoError(t, SaveRename(ctx, store, "42", &RenameRecord{ActivityID: 9, RenamedAt: day}))
+
+	records, err := ListRenames(ctx, store, "4", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, int64(3), records[0].ActivityID, "newest first")
+
+	records, err = ListRenames(ctx, store, "4", day.AddDate(0, 0, 1), day.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, RenameSourceWebhook, records[0].Source)
+
+	// Renaming an activity again keeps the earlier record
+	require.NoError(t, SaveRename(ctx, store, "4", &RenameRecord{
+		ActivityID:   3,
+		OriginalName: "Afternoon Run",
+		NewName:      "another joke",
+		Source:       RenameSourceWebhook,
+		RenamedAt:    day.AddDate(0, 0, 5),
+	}))
+	records, err = ListRenames(ctx, store, "4", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, records, 4)
+
+	records, err = ActivityRenames(ctx, store, "4", 3)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "Morning Run", records[0].OriginalName, "oldest first")
+	assert.Equal(t, "another joke", records[1].NewName)
+
+	// Marking a record undone updates it in place
+	undone := day.AddDate(0, 0, 6)
+	records[1].UndoneAt = &undone
+	require.NoError(t, SaveRename(ctx, store, "4", &records[1]))
+	records, err = ActivityRenames(ctx, store, "4", 3)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.NotNil(t, records[1].UndoneAt)
+
+	records, err = ActivityRenames(ctx, store, "4", 9)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	assert.Error(t, SaveRename(ctx, store, "", &RenameRecord{ActivityID: 1}))
+}
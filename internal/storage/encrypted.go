@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const tokenCipher = "aes-256-gcm"
+
+// ErrUnknownKey is returned when a record was encrypted with a key that is
+// not in the keyring
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring holds the AES-256 keys used to encrypt token records. New records
+// are always written with the active key; the others are kept so records
+// written before a rotation can still be read.
+type Keyring struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", activeID)
+	}
+
+	k := &Keyring{
+		activeID: activeID,
+		keys:     make(map[string]cipher.AEAD, len(keys)),
+	}
+
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %v", id, err)
+		}
+		k.keys[id] = aead
+	}
+
+	return k, nil
+}
+
+// ParseKeyring builds a keyring from a "id:base64key,id2:base64key" list
+func ParseKeyring(activeID, spec string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key entry %q, expected id:base64key", entry)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 for key %q: %v", id, err)
+		}
+		keys[id] = key
+	}
+
+	return NewKeyring(activeID, keys)
+}
+
+// ActiveKeyID returns the ID of the key used for new records
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// tokenEnvelope is the on-disk format of an encrypted token record
+type tokenEnvelope struct {
+	Cipher     string `json:"cipher"`
+	KeyID      string `json:"kid"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// EncryptedStore wraps a Store and encrypts token records with AES-GCM before
+// they reach the underlying backend. All other operations pass through.
+type EncryptedStore struct {
+	Store
+	keys *Keyring
+}
+
+func NewEncryptedStore(store Store, keys *Keyring) *EncryptedStore {
+	return &EncryptedStore{
+		Store: store,
+		keys:  keys,
+	}
+}
+
+// SetTTL passes through to the wrapped store, which may expire the key
+func (s *EncryptedStore) SetTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return SetTTL(ctx, s.Store, key, value, ttl)
+}
+
+// CreateTTL passes through to the wrapped store, which may expire the key
+func (s *EncryptedStore) CreateTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return CreateTTL(ctx, s.Store, key, value, ttl)
+}
+
+func (s *EncryptedStore) SaveTokens(ctx context.Context, athleteID string, tokens *Tokens) error {
+	if err := validateTokens(athleteID, tokens); err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(tokens)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+
+	aead := s.keys.keys[s.keys.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	// The athlete ID is authenticated data, so a record copied to another
+	// athlete's key fails to decrypt
+	ciphertext := aead.Seal(nil, nonce, plaintext, []byte(athleteID))
+
+	return s.Store.Set(ctx, tokensKey(athleteID), tokenEnvelope{
+		Cipher:     tokenCipher,
+		KeyID:      s.keys.activeID,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	})
+}
+
+func (s *EncryptedStore) LoadTokens(ctx context.Context, athleteID string) (*Tokens, error) {
+	tokens, _, err := s.loadTokens(ctx, athleteID)
+	return tokens, err
+}
+
+// loadTokens decrypts a token record and also returns the ID of the key it was
+// written with. Plaintext records from before encryption was enabled are
+// returned with an empty key ID.
+func (s *EncryptedStore) loadTokens(ctx context.Context, athleteID string) (*Tokens, string, error) {
+	if athleteID == "" {
+		return nil, "", fmt.Errorf("athlete ID cannot be empty")
+	}
+
+	key := tokensKey(athleteID)
+	var env tokenEnvelope
+	if err := s.Store.Load(ctx, key, &env); err != nil {
+		return nil, "", err
+	}
+
+	if env.Ciphertext == "" {
+		tokens, err := s.Store.LoadTokens(ctx, athleteID)
+		return tokens, "", err
+	}
+
+	if env.Cipher != tokenCipher {
+		return nil, "", fmt.Errorf("%w: %s: unsupported cipher %q", ErrCorrupt, key, env.Cipher)
+	}
+
+	aead, ok := s.keys.keys[env.KeyID]
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q for %s", ErrUnknownKey, env.KeyID, key)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, "", fmt.Errorf("%w: %s: invalid nonce", ErrCorrupt, key)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s: invalid ciphertext", ErrCorrupt, key)
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(athleteID))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s: decryption failed", ErrCorrupt, key)
+	}
+
+	var tokens Tokens
+	if err := decodeJSON(key, plaintext, &tokens); err != nil {
+		return nil, "", err
+	}
+	return &tokens, env.KeyID, nil
+}
+
+// ReencryptTokens rewrites every token record that is not encrypted with the
+// active key, including legacy plaintext records. It returns the number of
+// records rewritten.
+func (s *EncryptedStore) ReencryptTokens(ctx context.Context) (int, error) {
+	keys, err := s.Store.List(ctx, "athlete/")
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, key := range keys {
+		athleteID, ok := athleteFromTokensKey(key)
+		if !ok {
+			continue
+		}
+
+		tokens, keyID, err := s.loadTokens(ctx, athleteID)
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to read tokens for athlete %s: %w", athleteID, err)
+		}
+		if keyID == s.keys.activeID {
+			continue
+		}
+
+		if err := s.SaveTokens(ctx, athleteID, tokens); err != nil {
+			return rewritten, fmt.Errorf("failed to re-encrypt tokens for athlete %s: %w", athleteID, err)
+		}
+		log.Printf("Re-encrypted tokens for athlete %s (key %q -> %q)", athleteID, keyID, s.keys.activeID)
+		rewritten++
+	}
+
+	return rewritten, nil
+}
+
+// athleteFromTokensKey extracts the athlete ID from athlete/<id>/tokens.json
+func athleteFromTokensKey(key string) (string, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 || parts[0] != "athlete" || parts[2] != "tokens.json" || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyring(t *testing.T, activeID string, ids ...string) *Keyring {
+	t.Helper()
+	keys := make(map[string][]byte)
+	for i, id := range ids {
+		keys[id] = bytes.Repeat([]byte{byte(i + 1)}, 32)
+	}
+	k, err := NewKeyring(activeID, keys)
+	require.NoError(t, err)
+	return k
+}
+
+func TestEncryptedStore(t *testing.T) {
+	testStoreContract(t, NewEncryptedStore(NewMemoryStore(), testKeyring(t, "k1", "k1")))
+}
+
+func TestEncryptedStore_NoPlaintextAtRest(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+	store := NewEncryptedStore(inner, testKeyring(t, "k1", "k1"))
+
+	require.NoError(t, store.SaveTokens(ctx, "42", &Tokens{AccessToken: "secret-access", RefreshToken: "secret-refresh"}))
+
+	var env tokenEnvelope
+	require.NoError(t, inner.Load(ctx, tokensKey("42"), &env))
+	assert.Equal(t, "k1", env.KeyID)
+	assert.Equal(t, tokenCipher, env.Cipher)
+
+	raw, _ := json.Marshal(inner.data[tokensKey("42")])
+	assert.NotContains(t, string(raw), "secret-access")
+	assert.NotContains(t, string(raw), "secret-refresh")
+}
+
+func TestEncryptedStore_ReadsLegacyPlaintext(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+	require.NoError(t, inner.SaveTokens(ctx, "42", &Tokens{AccessToken: "a", RefreshToken: "r"}))
+
+	store := NewEncryptedStore(inner, testKeyring(t, "k1", "k1"))
+	tokens, err := store.LoadTokens(ctx, "42")
+	require.NoError(t, err)
+	assert.Equal(t, "r", tokens.RefreshToken)
+}
+
+func TestEncryptedStore_BoundToAthlete(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+	store := NewEncryptedStore(inner, testKeyring(t, "k1", "k1"))
+	require.NoError(t, store.SaveTokens(ctx, "42", &Tokens{AccessToken: "a", RefreshToken: "r"}))
+
+	// Copy athlete 42's record to athlete 43
+	inner.data[tokensKey("43")] = inner.data[tokensKey("42")]
+
+	_, err := store.LoadTokens(ctx, "43")
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestEncryptedStore_Rotation(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+
+	old := NewEncryptedStore(inner, testKeyring(t, "k1", "k1"))
+	require.NoError(t, old.SaveTokens(ctx, "1", &Tokens{AccessToken: "a1", RefreshToken: "r1"}))
+	require.NoError(t, inner.SaveTokens(ctx, "2", &Tokens{AccessToken: "a2", RefreshToken: "r2"}))
+	require.NoError(t, inner.Set(ctx, "athlete/2/settings.json", map[string]bool{"auto_rename": true}))
+
+	// A keyring without k1 cannot read the old record
+	_, err := NewEncryptedStore(inner, testKeyring(t, "k2", "k2")).LoadTokens(ctx, "1")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	rotated := NewEncryptedStore(inner, testKeyring(t, "k2", "k1", "k2"))
+	n, err := rotated.ReencryptTokens(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	for id, refresh := range map[string]string{"1": "r1", "2": "r2"} {
+		var env tokenEnvelope
+		require.NoError(t, inner.Load(ctx, tokensKey(id), &env))
+		assert.Equal(t, "k2", env.KeyID)
+
+		tokens, err := rotated.LoadTokens(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, refresh, tokens.RefreshToken)
+	}
+
+	// Running it again is a no-op
+	n, err = rotated.ReencryptTokens(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestParseKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+
+	k, err := ParseKeyring("k2", "k1:"+key+", k2:"+key)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", k.ActiveKeyID())
+
+	_, err = ParseKeyring("k3", "k1:"+key)
+	assert.Error(t, err)
+
+	_, err = ParseKeyring("k1", "k1:c2hvcnQ=")
+	assert.Error(t, err)
+
+	_, err = ParseKeyring("k1", "k1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileStore persists values as JSON files under a root directory, using the
+// same key layout as GCSStore (e.g. athlete/<id>/tokens.json).
+type FileStore struct {
+	root string
+}
+
+func NewFileStore(root string) (*FileStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("storage directory cannot be empty")
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage directory: %v", err)
+	}
+
+	if err := os.MkdirAll(abs, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %v", abs, err)
+	}
+
+	return &FileStore{root: abs}, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// path maps a key to a file below the root, rejecting keys that would escape it.
+func (s *FileStore) path(key string) (string, error) {
+	p := filepath.Join(s.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, s.root+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return p, nil
+}
+
+func (s *FileStore) Set(ctx context.Context, key string, value interface{}) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return fmt.Errorf("mkdir error: %v", err)
+	}
+
+	// Write to a temp file first so readers never see a partial value
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write error: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write error: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close error: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("rename error: %v", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) Create(ctx context.Context, key string, value interface{}) (bool, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("marshal error: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return false, fmt.Errorf("mkdir error: %v", err)
+	}
+
+	// O_EXCL makes creation fail if another writer got there first
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("write error: %v", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(p)
+		return false, fmt.Errorf("write error: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("close error: %v", err)
+	}
+
+	return true, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (interface{}, bool) {
+	p, err := s.path(key)
+	if err != nil {
+		log.Printf("Error reading from file store: %v", err)
+		return nil, false
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading from file store: %v", err)
+		}
+		return nil, false
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		log.Printf("Error unmarshaling value: %v", err)
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Load(ctx context.Context, key string, v interface{}) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return notFoundError(key)
+		}
+		return fmt.Errorf("failed to read %s: %v", key, err)
+	}
+
+	return decodeJSON(key, data, v)
+}
+
+func (s *FileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %v", err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *FileStore) SaveTokens(ctx context.Context, athleteID string, tokens *Tokens) error {
+	if err := validateTokens(athleteID, tokens); err != nil {
+		return err
+	}
+	return s.Set(ctx, tokensKey(athleteID), tokens)
+}
+
+func (s *FileStore) LoadTokens(ctx context.Context, athleteID string) (*Tokens, error) {
+	return loadTokens(ctx, s, athleteID)
+}
+
+func (s *FileStore) DeleteTokens(ctx context.Context, athleteID string) error {
+	if athleteID == "" {
+		return fmt.Errorf("athlete ID cannot be empty")
+	}
+	return s.Delete(ctx, tokensKey(athleteID))
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	testStoreContract(t, store)
+}
+
+func TestFileStore_KeyLayout(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, store.SaveTokens(context.Background(), "42", &Tokens{AccessToken: "a"}))
+
+	_, err = os.Stat(filepath.Join(dir, "athlete", "42", "tokens.json"))
+	assert.NoError(t, err)
+}
+
+func TestFileStore_RejectsEscapingKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	assert.Error(t, store.Set(ctx, "../outside.json", "value"))
+	_, exists := store.Get(ctx, "../outside.json")
+	assert.False(t, exists)
+}
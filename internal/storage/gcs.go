@@ -3,18 +3,22 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"sort"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 type GCSStore struct {
 	client     *storage.Client
 	bucketName string
-	ctx        context.Context
 }
 
 func NewGCSStore(ctx context.Context, bucketName string, credentialsFile string) (*GCSStore, error) {
@@ -35,11 +39,10 @@ func NewGCSStore(ctx context.Context, bucketName string, credentialsFile string)
 	store := &GCSStore{
 		client:     client,
 		bucketName: bucketName,
-		ctx:        ctx,
 	}
 
 	// Verify bucket exists and is accessible
-	if err := store.verifyBucket(); err != nil {
+	if err := store.verifyBucket(ctx); err != nil {
 		client.Close()
 		return nil, err
 	}
@@ -47,9 +50,9 @@ func NewGCSStore(ctx context.Context, bucketName string, credentialsFile string)
 	return store, nil
 }
 
-func (s *GCSStore) verifyBucket() error {
+func (s *GCSStore) verifyBucket(ctx context.Context) error {
 	bucket := s.client.Bucket(s.bucketName)
-	_, err := bucket.Attrs(s.ctx)
+	_, err := bucket.Attrs(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to access bucket %s: %v", s.bucketName, err)
 	}
@@ -60,7 +63,7 @@ func (s *GCSStore) Close() error {
 	return s.client.Close()
 }
 
-func (s *GCSStore) Set(key string, value interface{}) error {
+func (s *GCSStore) Set(ctx context.Context, key string, value interface{}) error {
 	data, err := json.Marshal(value)
 	if err != nil {
 		log.Printf("ERROR: Failed to marshal value: %v", err)
@@ -68,7 +71,7 @@ func (s *GCSStore) Set(key string, value interface{}) error {
 	}
 
 	obj := s.client.Bucket(s.bucketName).Object(key)
-	w := obj.NewWriter(s.ctx)
+	w := obj.NewWriter(ctx)
 
 	log.Printf("DEBUG: Writing to key: %s", key)
 	if _, err := w.Write(data); err != nil {
@@ -84,9 +87,35 @@ func (s *GCSStore) Set(key string, value interface{}) error {
 	return nil
 }
 
-func (s *GCSStore) Get(key string) (interface{}, bool) {
+func (s *GCSStore) Create(ctx context.Context, key string, value interface{}) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("marshal error: %v", err)
+	}
+
+	// The DoesNotExist precondition makes GCS reject the write if the object exists
+	obj := s.client.Bucket(s.bucketName).Object(key).If(storage.Conditions{DoesNotExist: true})
+	w := obj.NewWriter(ctx)
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return false, fmt.Errorf("write error: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			return false, nil
+		}
+		return false, fmt.Errorf("close error: %v", err)
+	}
+
+	return true, nil
+}
+
+func (s *GCSStore) Get(ctx context.Context, key string) (interface{}, bool) {
 	obj := s.client.Bucket(s.bucketName).Object(key)
-	r, err := obj.NewReader(s.ctx)
+	r, err := obj.NewReader(ctx)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
 			return nil, false
@@ -111,9 +140,9 @@ func (s *GCSStore) Get(key string) (interface{}, bool) {
 	return value, true
 }
 
-func (s *GCSStore) Delete(key string) error {
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
 	obj := s.client.Bucket(s.bucketName).Object(key)
-	if err := obj.Delete(s.ctx); err != nil {
+	if err := obj.Delete(ctx); err != nil {
 		if err == storage.ErrObjectNotExist {
 			return nil
 		}
@@ -122,46 +151,78 @@ func (s *GCSStore) Delete(key string) error {
 	return nil
 }
 
-// TokenStore implementation
-func (s *GCSStore) SetTokens(athleteID string, tokens interface{}) error {
-	key := fmt.Sprintf("athlete/%s/tokens.json", athleteID)
-	log.Printf("DEBUG: Attempting to store tokens for athlete %s", athleteID)
-	log.Printf("DEBUG: Using bucket: %s", s.bucketName)
+func (s *GCSStore) Load(ctx context.Context, key string, v interface{}) error {
+	r, err := s.client.Bucket(s.bucketName).Object(key).NewReader(ctx)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return notFoundError(key)
+		}
+		return fmt.Errorf("failed to read %s from GCS: %v", key, err)
+	}
+	defer r.Close()
 
-	err := s.Set(key, tokens)
+	data, err := io.ReadAll(r)
 	if err != nil {
-		log.Printf("ERROR: Failed to store tokens in GCS: %v", err)
-		return fmt.Errorf("storage error: %v", err)
+		return fmt.Errorf("failed to read %s from GCS: %v", key, err)
 	}
 
-	log.Printf("SUCCESS: Stored tokens for athlete %s", athleteID)
-	return nil
+	return decodeJSON(key, data, v)
 }
 
-func (s *GCSStore) GetTokens(athleteID string) (interface{}, bool) {
-	if athleteID == "" {
-		log.Printf("Warning: Attempted to get tokens with empty athlete ID")
-		return nil, false
+func (s *GCSStore) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	it := s.client.Bucket(s.bucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %v", err)
+		}
+		keys = append(keys, attrs.Name)
 	}
 
-	key := fmt.Sprintf("athlete/%s/tokens.json", athleteID)
-	log.Printf("DEBUG: Retrieving tokens for athlete %s", athleteID)
+	sort.Strings(keys)
+	return keys, nil
+}
 
-	value, exists := s.Get(key)
-	if !exists {
-		log.Printf("DEBUG: No tokens found for athlete %s", athleteID)
-		return nil, false
+// TokenStore implementation
+func (s *GCSStore) SaveTokens(ctx context.Context, athleteID string, tokens *Tokens) error {
+	if err := validateTokens(athleteID, tokens); err != nil {
+		return err
 	}
 
-	log.Printf("DEBUG: Successfully retrieved tokens for athlete %s", athleteID)
-	return value, true
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+
+	log.Printf("DEBUG: Attempting to store tokens for athlete %s", athleteID)
+	w := s.client.Bucket(s.bucketName).Object(tokensKey(athleteID)).NewWriter(ctx)
+	w.ContentType = "application/json"
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		log.Printf("ERROR: Failed to store tokens in GCS: %v", err)
+		return fmt.Errorf("storage error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		log.Printf("ERROR: Failed to store tokens in GCS: %v", err)
+		return fmt.Errorf("storage error: %v", err)
+	}
+
+	log.Printf("SUCCESS: Stored tokens for athlete %s", athleteID)
+	return nil
 }
 
-func (s *GCSStore) DeleteTokens(athleteID string) error {
+func (s *GCSStore) LoadTokens(ctx context.Context, athleteID string) (*Tokens, error) {
+	return loadTokens(ctx, s, athleteID)
+}
+
+func (s *GCSStore) DeleteTokens(ctx context.Context, athleteID string) error {
 	if athleteID == "" {
 		return fmt.Errorf("athlete ID cannot be empty")
 	}
-
-	key := fmt.Sprintf("athlete/%s/tokens.json", athleteID)
-	return s.Delete(key)
+	return s.Delete(ctx, tokensKey(athleteID))
 }
@@ -49,12 +49,12 @@ func TestGCSConnection(t *testing.T) {
 	testValue := "test-value"
 
 	// Test Set
-	if err := store.Set(testKey, testValue); err != nil {
+	if err := store.Set(ctx, testKey, testValue); err != nil {
 		t.Fatalf("Failed to set value: %v", err)
 	}
 
 	// Test Get
-	value, exists := store.Get(testKey)
+	value, exists := store.Get(ctx, testKey)
 	if !exists {
 		t.Fatal("Value should exist but doesn't")
 	}
@@ -63,7 +63,7 @@ func TestGCSConnection(t *testing.T) {
 	}
 
 	// Test Delete
-	if err := store.Delete(testKey); err != nil {
+	if err := store.Delete(ctx, testKey); err != nil {
 		t.Fatalf("Failed to delete value: %v", err)
 	}
 }
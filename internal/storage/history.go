@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Where a rename came from
+const (
+	RenameSourceManual   = "manual"
+	RenameSourceWebhook  = "webhook"
+	RenameSourceBackfill = "backfill"
+)
+
+// RenameRecord is kept for every activity we rename, so the original name can
+// be restored
+type RenameRecord struct {
+	ActivityID   int64      `json:"activity_id"`
+	OriginalName string     `json:"original_name"`
+	NewName      string     `json:"new_name"`
+	JokeID       string     `json:"joke_id"`
+	Source       string     `json:"source"`
+	RenamedAt    time.Time  `json:"renamed_at"`
+	UndoneAt     *time.Time `json:"undone_at,omitempty"`
+}
+
+// renameKey holds one rename of an activity. Every rename gets its own key,
+// ordered by time, so renaming an activity again keeps the earlier records
+// and the name it had before the first one.
+func renameKey(athleteID string, activityID int64, renamedAt time.Time) string {
+	return fmt.Sprintf("%srenames/%d/%020d.json", athletePrefix(athleteID), activityID, renamedAt.UnixNano())
+}
+
+// SaveRename records a rename of one of the athlete's activities. Saving a
+// record again, e.g. to mark it undone, updates it in place.
+func SaveRename(ctx context.Context, s Store, athleteID string, record *RenameRecord) error {
+	if athleteID == "" {
+		return fmt.Errorf("athlete ID cannot be empty")
+	}
+	return s.Set(ctx, renameKey(athleteID, record.ActivityID, record.RenamedAt), record)
+}
+
+// ActivityRenames returns every rename of an activity, oldest first
+func ActivityRenames(ctx context.Context, s Store, athleteID string, activityID int64) ([]RenameRecord, error) {
+	prefix := fmt.Sprintf("%srenames/%d/", athletePrefix(athleteID), activityID)
+	keys, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list renames of activity %d: %v", activityID, err)
+	}
+
+	records := []RenameRecord{}
+	for _, key := range keys {
+		var record RenameRecord
+		if err := s.Load(ctx, key, &record); err != nil {
+			return nil, fmt.Errorf("failed to load rename %s: %w", key, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// LatestRename returns the most recent rename of an activity, or ErrNotFound
+// if it was never renamed
+func LatestRename(ctx context.Context, s Store, athleteID string, activityID int64) (*RenameRecord, error) {
+	prefix := fmt.Sprintf("%srenames/%d/", athletePrefix(athleteID), activityID)
+	keys, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list renames of activity %d: %v", activityID, err)
+	}
+	if len(keys) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var record RenameRecord
+	if err := s.Load(ctx, keys[len(keys)-1], &record); err != nil {
+		return nil, fmt.Errorf("failed to load rename %s: %w", keys[len(keys)-1], err)
+	}
+	return &record, nil
+}
+
+// ListRenames returns every rename the athlete made in [from, to), newest
+// first. Zero times leave the range open.
+func ListRenames(ctx context.Context, s Store, athleteID string, from, to time.Time) ([]RenameRecord, error) {
+	keys, err := s.List(ctx, athletePrefix(athleteID)+"renames/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list renames for athlete %s: %v", athleteID, err)
+	}
+
+	records := []RenameRecord{}
+	for _, key := range keys {
+		var record RenameRecord
+		if err := s.Load(ctx, key, &record); err != nil {
+			return nil, fmt.Errorf("failed to load rename %s: %w", key, err)
+		}
+		if (!from.IsZero() && record.RenamedAt.Before(from)) || (!to.IsZero() && !record.RenamedAt.Before(to)) {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].RenamedAt.After(records[j].RenamedAt)
+	})
+	return records, nil
+}
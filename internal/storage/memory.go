@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore keeps everything in process memory. Values are stored as JSON so
+// Get returns the same shapes as the persistent backends. Useful for local
+// development and tests; all data is lost on restart.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		data: make(map[string][]byte),
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = data
+	return nil
+}
+
+func (s *MemoryStore) Create(ctx context.Context, key string, value interface{}) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("marshal error: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.data[key]; exists {
+		return false, nil
+	}
+	s.data[key] = data
+	return true, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (interface{}, bool) {
+	s.mu.RLock()
+	data, ok := s.data[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		log.Printf("Error unmarshaling value: %v", err)
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *MemoryStore) Load(ctx context.Context, key string, v interface{}) error {
+	s.mu.RLock()
+	data, ok := s.data[key]
+	s.mu.RUnlock()
+	if !ok {
+		return notFoundError(key)
+	}
+	return decodeJSON(key, data, v)
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []string{}
+	for key := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *MemoryStore) SaveTokens(ctx context.Context, athleteID string, tokens *Tokens) error {
+	if err := validateTokens(athleteID, tokens); err != nil {
+		return err
+	}
+	return s.Set(ctx, tokensKey(athleteID), tokens)
+}
+
+func (s *MemoryStore) LoadTokens(ctx context.Context, athleteID string) (*Tokens, error) {
+	return loadTokens(ctx, s, athleteID)
+}
+
+func (s *MemoryStore) DeleteTokens(ctx context.Context, athleteID string) error {
+	if athleteID == "" {
+		return fmt.Errorf("athlete ID cannot be empty")
+	}
+	return s.Delete(ctx, tokensKey(athleteID))
+}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisOptions configures a RedisStore
+type RedisOptions struct {
+	URL string
+	// Timeout bounds every call made to Redis
+	Timeout time.Duration
+}
+
+// RedisStore stores values in Redis using the same key layout as the other
+// backends (e.g. athlete/<id>/tokens.json). Keys never expire unless written
+// with SetTTL or CreateTTL.
+type RedisStore struct {
+	client  *redis.Client
+	timeout time.Duration
+}
+
+func NewRedisStore(opts RedisOptions) (*RedisStore, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("redis URL cannot be empty")
+	}
+
+	opt, err := redis.ParseURL(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse redis URL: %v", err)
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	store := &RedisStore{
+		client:  redis.NewClient(opt),
+		timeout: timeout,
+	}
+
+	// Test the connection
+	ctx, cancel := store.context(context.Background())
+	defer cancel()
+
+	if err := store.client.Ping(ctx).Err(); err != nil {
+		store.client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+
+	return store, nil
+}
+
+// context bounds a call to Redis by the store timeout on top of the caller's
+// own deadline
+func (s *RedisStore) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisStore) set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	if err := s.client.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store value in redis: %v", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value interface{}) error {
+	return s.set(ctx, key, value, 0)
+}
+
+// SetTTL stores value at key and lets Redis expire it after ttl
+func (s *RedisStore) SetTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return s.set(ctx, key, value, ttl)
+}
+
+func (s *RedisStore) Create(ctx context.Context, key string, value interface{}) (bool, error) {
+	return s.create(ctx, key, value, 0)
+}
+
+// CreateTTL is Create for a key Redis expires after ttl
+func (s *RedisStore) CreateTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return s.create(ctx, key, value, ttl)
+}
+
+func (s *RedisStore) create(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("marshal error: %v", err)
+	}
+
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	created, err := s.client.SetNX(ctx, key, data, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to store value in redis: %v", err)
+	}
+	return created, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (interface{}, bool) {
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Error retrieving value from redis: %v", err)
+		}
+		return nil, false
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		log.Printf("Error unmarshaling value: %v", err)
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to delete key: %v", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Load(ctx context.Context, key string, v interface{}) error {
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return notFoundError(key)
+		}
+		return fmt.Errorf("failed to read %s from redis: %v", key, err)
+	}
+
+	return decodeJSON(key, data, v)
+}
+
+func (s *RedisStore) List(ctx context.Context, prefix string) ([]string, error) {
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	keys := []string{}
+	iter := s.client.Scan(ctx, 0, escapePattern(prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list keys: %v", err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// escapePattern escapes glob characters so a prefix matches literally in SCAN
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *RedisStore) SaveTokens(ctx context.Context, athleteID string, tokens *Tokens) error {
+	if err := validateTokens(athleteID, tokens); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
+	}
+
+	ctx, cancel := s.context(ctx)
+	defer cancel()
+
+	// No expiry: the refresh token stays valid until the athlete revokes it
+	if err := s.client.Set(ctx, tokensKey(athleteID), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store tokens in redis: %v", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) LoadTokens(ctx context.Context, athleteID string) (*Tokens, error) {
+	return loadTokens(ctx, s, athleteID)
+}
+
+func (s *RedisStore) DeleteTokens(ctx context.Context, athleteID string) error {
+	if athleteID == "" {
+		return fmt.Errorf("athlete ID cannot be empty")
+	}
+	return s.Delete(ctx, tokensKey(athleteID))
+}
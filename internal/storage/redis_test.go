@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL_TEST")
+	if redisURL == "" {
+		t.Skip("REDIS_URL_TEST not set")
+	}
+
+	store, err := NewRedisStore(RedisOptions{URL: redisURL})
+	require.NoError(t, err)
+	defer store.Close()
+
+	testStoreContract(t, store)
+
+	t.Run("tokens never expire", func(t *testing.T) {
+		ctx, cancel := store.context(context.Background())
+		defer cancel()
+
+		require.NoError(t, store.SaveTokens(ctx, "ttl-check", &Tokens{RefreshToken: "r"}))
+		defer store.DeleteTokens(ctx, "ttl-check")
+
+		ttl, err := store.client.TTL(ctx, tokensKey("ttl-check")).Result()
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(-1), ttl)
+	})
+
+	t.Run("only keys written with a TTL expire", func(t *testing.T) {
+		ctx, cancel := store.context(context.Background())
+		defer cancel()
+
+		require.NoError(t, store.Set(ctx, "ttl/plain.json", "v"))
+		defer store.Delete(ctx, "ttl/plain.json")
+		require.NoError(t, SetTTL(ctx, store, "ttl/expiring.json", "v", time.Hour))
+		defer store.Delete(ctx, "ttl/expiring.json")
+
+		ttl, err := store.client.TTL(ctx, "ttl/plain.json").Result()
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(-1), ttl)
+
+		ttl, err = store.client.TTL(ctx, "ttl/expiring.json").Result()
+		require.NoError(t, err)
+		require.True(t, ttl > 0 && ttl <= time.Hour)
+	})
+}
@@ -1,17 +1,78 @@
 package storage
 
-// Store defines the interface for storage implementations
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no record exists for the requested key
+	ErrNotFound = errors.New("not found")
+	// ErrCorrupt is returned when a stored record cannot be decoded
+	ErrCorrupt = errors.New("corrupt data")
+)
+
+// Store defines the interface for storage implementations. Every operation
+// takes a context so callers can bound how long they wait on the backend.
 type Store interface {
 	// Generic key-value operations
-	Set(key string, value interface{}) error
-	Get(key string) (interface{}, bool)
-	Delete(key string) error
+	Set(ctx context.Context, key string, value interface{}) error
+	Get(ctx context.Context, key string) (interface{}, bool)
+	Delete(ctx context.Context, key string) error
+
+	// Create stores value only if key does not exist yet, atomically. It
+	// returns false when the key already existed.
+	Create(ctx context.Context, key string, value interface{}) (bool, error)
+
+	// Load decodes the JSON value stored at key into v. It returns
+	// ErrNotFound when the key does not exist and ErrCorrupt when the
+	// value cannot be decoded into v.
+	Load(ctx context.Context, key string, v interface{}) error
+
+	// List returns all keys starting with prefix, sorted
+	List(ctx context.Context, prefix string) ([]string, error)
 
 	// Token-specific operations
-	SetTokens(athleteID string, tokens interface{}) error
-	GetTokens(athleteID string) (interface{}, bool)
-	DeleteTokens(athleteID string) error
+	TokenStore
 
 	// Cleanup
 	Close() error
 }
+
+// expiringStore is implemented by backends that can expire keys themselves
+type expiringStore interface {
+	SetTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	CreateTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+}
+
+// SetTTL stores value at key like Set and asks the backend to drop it after
+// ttl. Backends without expiry keep the key until it is deleted, so readers
+// must still check the age of what they load.
+func SetTTL(ctx context.Context, s Store, key string, value interface{}, ttl time.Duration) error {
+	if es, ok := s.(expiringStore); ok {
+		return es.SetTTL(ctx, key, value, ttl)
+	}
+	return s.Set(ctx, key, value)
+}
+
+// CreateTTL is Create for a key that may expire after ttl, see SetTTL
+func CreateTTL(ctx context.Context, s Store, key string, value interface{}, ttl time.Duration) (bool, error) {
+	if es, ok := s.(expiringStore); ok {
+		return es.CreateTTL(ctx, key, value, ttl)
+	}
+	return s.Create(ctx, key, value)
+}
+
+func notFoundError(key string) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, key)
+}
+
+func decodeJSON(key string, data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorrupt, key, err)
+	}
+	return nil
+}
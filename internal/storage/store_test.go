@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStoreContract exercises the behaviour every Store implementation must share
+func testStoreContract(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	t.Run("set get delete", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "test-key", "test-value"))
+
+		value, exists := store.Get(ctx, "test-key")
+		require.True(t, exists)
+		assert.Equal(t, "test-value", value)
+
+		require.NoError(t, store.Delete(ctx, "test-key"))
+		_, exists = store.Get(ctx, "test-key")
+		assert.False(t, exists)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, exists := store.Get(ctx, "does/not/exist.json")
+		assert.False(t, exists)
+		assert.NoError(t, store.Delete(ctx, "does/not/exist.json"))
+	})
+
+	t.Run("create", func(t *testing.T) {
+		defer store.Delete(ctx, "create/once.json")
+
+		created, err := store.Create(ctx, "create/once.json", "first")
+		require.NoError(t, err)
+		assert.True(t, created)
+
+		created, err = store.Create(ctx, "create/once.json", "second")
+		require.NoError(t, err)
+		assert.False(t, created)
+
+		value, exists := store.Get(ctx, "create/once.json")
+		require.True(t, exists)
+		assert.Equal(t, "first", value)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		defer store.Delete(ctx, "ttl/set.json")
+		defer store.Delete(ctx, "ttl/create.json")
+
+		require.NoError(t, SetTTL(ctx, store, "ttl/set.json", "value", time.Hour))
+		value, exists := store.Get(ctx, "ttl/set.json")
+		require.True(t, exists)
+		assert.Equal(t, "value", value)
+
+		created, err := CreateTTL(ctx, store, "ttl/create.json", "first", time.Hour)
+		require.NoError(t, err)
+		assert.True(t, created)
+		created, err = CreateTTL(ctx, store, "ttl/create.json", "second", time.Hour)
+		require.NoError(t, err)
+		assert.False(t, created)
+	})
+
+	t.Run("load", func(t *testing.T) {
+		type record struct {
+			Name  string `json:"name"`
+			Count int    `json:"count"`
+		}
+		require.NoError(t, store.Set(ctx, "records/a.json", record{Name: "a", Count: 2}))
+		defer store.Delete(ctx, "records/a.json")
+
+		var got record
+		require.NoError(t, store.Load(ctx, "records/a.json", &got))
+		assert.Equal(t, record{Name: "a", Count: 2}, got)
+
+		assert.ErrorIs(t, store.Load(ctx, "records/missing.json", &got), ErrNotFound)
+
+		require.NoError(t, store.Set(ctx, "records/bad.json", "not an object"))
+		defer store.Delete(ctx, "records/bad.json")
+		assert.ErrorIs(t, store.Load(ctx, "records/bad.json", &got), ErrCorrupt)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		for _, key := range []string{"list/b/1.json", "list/a/2.json", "list/a/1.json", "other/1.json"} {
+			require.NoError(t, store.Set(ctx, key, 1))
+			defer store.Delete(ctx, key)
+		}
+
+		keys, err := store.List(ctx, "list/a/")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"list/a/1.json", "list/a/2.json"}, keys)
+
+		keys, err = store.List(ctx, "list/")
+		require.NoError(t, err)
+		assert.Len(t, keys, 3)
+
+		keys, err = store.List(ctx, "nothing/")
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		tokens := &Tokens{
+			TokenType:    "Bearer",
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			ExpiresAt:    1700000000,
+		}
+		require.NoError(t, store.SaveTokens(ctx, "42", tokens))
+
+		_, exists := store.Get(ctx, "athlete/42/tokens.json")
+		require.True(t, exists, "tokens must use the shared key layout")
+
+		got, err := store.LoadTokens(ctx, "42")
+		require.NoError(t, err)
+		assert.Equal(t, tokens, got)
+
+		require.NoError(t, store.DeleteTokens(ctx, "42"))
+		_, err = store.LoadTokens(ctx, "42")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		assert.Error(t, store.SaveTokens(ctx, "", tokens))
+		assert.Error(t, store.SaveTokens(ctx, "42", nil))
+	})
+
+	t.Run("corrupt tokens", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "athlete/43/tokens.json", "not a token record"))
+		defer store.Delete(ctx, "athlete/43/tokens.json")
+
+		_, err := store.LoadTokens(ctx, "43")
+		assert.ErrorIs(t, err, ErrCorrupt)
+	})
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tokens are the OAuth tokens persisted for an athlete
+type Tokens struct {
+	TokenType    string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// TokenStore persists typed OAuth tokens per athlete
+type TokenStore interface {
+	SaveTokens(ctx context.Context, athleteID string, tokens *Tokens) error
+	LoadTokens(ctx context.Context, athleteID string) (*Tokens, error)
+	DeleteTokens(ctx context.Context, athleteID string) error
+}
+
+// tokensKey is the key under which an athlete's OAuth tokens are stored.
+// All backends share this layout.
+func tokensKey(athleteID string) string {
+	return fmt.Sprintf("athlete/%s/tokens.json", athleteID)
+}
+
+func validateTokens(athleteID string, tokens *Tokens) error {
+	if athleteID == "" {
+		return fmt.Errorf("athlete ID cannot be empty")
+	}
+	if tokens == nil {
+		return fmt.Errorf("tokens cannot be nil")
+	}
+	return nil
+}
+
+// loader is the generic Load every backend implements
+type loader interface {
+	Load(ctx context.Context, key string, v interface{}) error
+}
+
+// loadTokens reads an athlete's tokens through the generic Load of a backend
+func loadTokens(ctx context.Context, s loader, athleteID string) (*Tokens, error) {
+	if athleteID == "" {
+		return nil, fmt.Errorf("athlete ID cannot be empty")
+	}
+
+	var tokens Tokens
+	if err := s.Load(ctx, tokensKey(athleteID), &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.AccessToken == "" && tokens.RefreshToken == "" {
+		return nil, fmt.Errorf("%w: tokens for athlete %s are empty", ErrCorrupt, athleteID)
+	}
+	return &tokens, nil
+}
@@ -2,28 +2,134 @@ package strava
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
-	baseURL                = "https://www.strava.com/api/v3"
-	authURL                = "https://www.strava.com/oauth/token"
-	activitiesURL          = baseURL + "/athlete/activities"
-	webhookSubscriptionURL = baseURL + "/push_subscriptions"
+	// DefaultAPIURL and DefaultOAuthURL are Strava's production endpoints,
+	// used unless WithAPIURL or WithOAuthURL is given
+	DefaultAPIURL   = "https://www.strava.com/api/v3"
+	DefaultOAuthURL = "https://www.strava.com/oauth"
+
+	// refreshLeeway is how long before expiry the access token is refreshed
+	refreshLeeway = 5 * time.Minute
+
+	// DefaultTimeout bounds each client call unless WithTimeout is given
+	DefaultTimeout = 15 * time.Second
+
+	// DefaultMaxAttempts is how often an idempotent request is sent before
+	// a server or network error is returned, unless WithRetries is given
+	DefaultMaxAttempts = 3
+
+	// DefaultRetryBackoff is the base delay between attempts; it doubles with
+	// every attempt up to maxRetryBackoff and is jittered
+	DefaultRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff     = 5 * time.Second
 )
 
+// TokenRefreshFunc is called with the new tokens every time the client
+// refreshes them, so they can be persisted.
+type TokenRefreshFunc func(ctx context.Context, tokens *TokenResponse) error
+
+// Option configures optional Client behaviour
+type Option func(*Client)
+
+// WithAPIURL sends API requests to apiURL instead of DefaultAPIURL, for
+// example a local fake or a proxy. An empty URL keeps the default.
+func WithAPIURL(apiURL string) Option {
+	return func(c *Client) {
+		if apiURL != "" {
+			c.apiURL = strings.TrimSuffix(apiURL, "/")
+		}
+	}
+}
+
+// WithOAuthURL sends token refreshes and deauthorizations to oauthURL
+// instead of DefaultOAuthURL. An empty URL keeps the default.
+func WithOAuthURL(oauthURL string) Option {
+	return func(c *Client) {
+		if oauthURL != "" {
+			c.oauthURL = strings.TrimSuffix(oauthURL, "/")
+		}
+	}
+}
+
+// WithHTTPClient sends requests through httpClient instead of a client of
+// our own. The client's own Timeout still applies on top of WithTimeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+// WithExpiresAt sets the expiry (unix seconds) of the access token, enabling
+// proactive refresh before it expires.
+func WithExpiresAt(expiresAt int64) Option {
+	return func(c *Client) {
+		c.expiresAt = expiresAt
+	}
+}
+
+// WithRetries sets how many times an idempotent request is attempted and the
+// base delay between attempts. One attempt disables retries.
+func WithRetries(maxAttempts int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxAttempts = maxAttempts
+		c.retryBackoff = backoff
+	}
+}
+
+// WithTimeout bounds how long each call, including a token refresh and retry,
+// may take. Zero disables the client's own timeout, leaving only the
+// caller's context deadline.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRateLimiter tracks rate limits in l instead of DefaultRateLimiter
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = l
+	}
+}
+
+// WithTokenRefreshFunc registers a callback that receives refreshed tokens
+func WithTokenRefreshFunc(fn TokenRefreshFunc) Option {
+	return func(c *Client) {
+		c.onRefresh = fn
+	}
+}
+
 type Client struct {
+	mu           sync.Mutex
 	accessToken  string
 	refreshToken string
+	expiresAt    int64
 	clientID     string
 	clientSecret string
+	apiURL       string
+	oauthURL     string
 	httpClient   *http.Client
+	timeout      time.Duration
+	limiter      *RateLimiter
+	maxAttempts  int
+	retryBackoff time.Duration
+	onRefresh    TokenRefreshFunc
 }
 
 type TokenResponse struct {
@@ -45,38 +151,79 @@ type WebhookSubscription struct {
 }
 
 type StravaClientInterface interface {
-	GetActivity(id int64) (*Activity, error)
-	UpdateActivity(id int64, name string) error
-	GetAuthenticatedAthlete() (*Athlete, error)
-	GetAthleteActivities(page, perPage int, before, after int64) ([]Activity, error)
+	GetActivity(ctx context.Context, id int64) (*Activity, error)
+	UpdateActivity(ctx context.Context, id int64, name string) error
+	GetAuthenticatedAthlete(ctx context.Context) (*Athlete, error)
+	GetAthleteActivities(ctx context.Context, page, perPage int, before, after int64) ([]Activity, error)
 }
 
-func NewClient(accessToken, refreshToken, clientID, clientSecret string) *Client {
-	return &Client{
+// WebhookSubscriptionClient manages the app's push subscriptions
+type WebhookSubscriptionClient interface {
+	ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error)
+	CreateWebhookSubscription(ctx context.Context, callbackURL, verifyToken string) (*WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, subscriptionID int64) error
+}
+
+func NewClient(accessToken, refreshToken, clientID, clientSecret string, opts ...Option) *Client {
+	c := &Client{
 		accessToken:  accessToken,
 		refreshToken: refreshToken,
 		clientID:     clientID,
 		clientSecret: clientSecret,
+		apiURL:       DefaultAPIURL,
+		oauthURL:     DefaultOAuthURL,
 		httpClient:   &http.Client{},
+		timeout:      DefaultTimeout,
+		limiter:      DefaultRateLimiter,
+		maxAttempts:  DefaultMaxAttempts,
+		retryBackoff: DefaultRetryBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
-func (c *Client) RefreshToken() (*TokenResponse, error) {
+// callContext applies the client timeout to a single call
+func (c *Client) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(ctx, c.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// RefreshToken exchanges the refresh token for a new access token, updates the
+// client and hands the new tokens to the registered TokenRefreshFunc.
+func (c *Client) RefreshToken(ctx context.Context) (*TokenResponse, error) {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refreshLocked(ctx)
+}
+
+func (c *Client) refreshLocked(ctx context.Context) (*TokenResponse, error) {
 	data := url.Values{}
 	data.Set("client_id", c.clientID)
 	data.Set("client_secret", c.clientSecret)
 	data.Set("refresh_token", c.refreshToken)
 	data.Set("grant_type", "refresh_token")
 
-	resp, err := c.httpClient.PostForm(authURL, data)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.oauthURL+"/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to refresh token: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to refresh token: status=%d, body=%s", resp.StatusCode, body)
+		return nil, fmt.Errorf("failed to refresh token: %w", newAPIError(resp))
 	}
 
 	var tokenResp TokenResponse
@@ -87,43 +234,171 @@ func (c *Client) RefreshToken() (*TokenResponse, error) {
 	// Update client's tokens
 	c.accessToken = tokenResp.AccessToken
 	c.refreshToken = tokenResp.RefreshToken
+	c.expiresAt = tokenResp.ExpiresAt
+
+	// Persist the new tokens; Strava may have rotated the refresh token
+	if c.onRefresh != nil {
+		if err := c.onRefresh(ctx, &tokenResp); err != nil {
+			log.Printf("Warning: failed to persist refreshed tokens: %v", err)
+		}
+	}
 
 	return &tokenResp, nil
 }
 
-// handle automatic token refresh
+// currentToken returns a usable access token, refreshing it first when it is
+// about to expire.
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.expiresAt != 0 && time.Now().Add(refreshLeeway).Unix() >= c.expiresAt {
+		log.Printf("Access token expires soon, refreshing")
+		if _, err := c.refreshLocked(ctx); err != nil {
+			return "", fmt.Errorf("token refresh failed: %w", err)
+		}
+	}
+
+	return c.accessToken, nil
+}
+
+// send performs an API request, retrying idempotent ones after server and
+// network errors. The last response is returned as is for the caller to
+// turn into an APIError.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if idempotent(req.Method) && c.maxAttempts > 1 {
+		attempts = c.maxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.sendOnce(req)
+		retry := attempt < attempts && req.Context().Err() == nil
+
+		var limited *RateLimitError
+		switch {
+		case err != nil && (errors.As(err, &limited) || !retry):
+			return nil, err
+		case err != nil:
+			log.Printf("Strava %s %s failed (attempt %d), retrying: %v", req.Method, req.URL.Path, attempt, err)
+		case retryableStatus(resp.StatusCode) && retry:
+			resp.Body.Close()
+			log.Printf("Strava %s %s returned %d (attempt %d), retrying", req.Method, req.URL.Path, resp.StatusCode, attempt)
+		default:
+			return resp, nil
+		}
+
+		if err := c.waitToRetry(req, attempt); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitToRetry sleeps for the jittered backoff and rewinds the request body
+func (c *Client) waitToRetry(req *http.Request, attempt int) error {
+	delay := c.retryBackoff << (attempt - 1)
+	if delay <= 0 || delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	// Spread retries from concurrent callers over the second half of the delay
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("error rewinding request body: %v", err)
+		}
+		req.Body = body
+	}
+	return nil
+}
+
+// idempotent reports whether a request can safely be sent more than once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// sendOnce performs a single request within the app's rate limit. A 429
+// response is turned into a *RateLimitError.
+func (c *Client) sendOnce(req *http.Request) (*http.Response, error) {
+	if err := c.limiter.Reserve(req.Method == http.MethodGet); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		err := c.limiter.Limited(resp.Header)
+		log.Printf("Strava rate limit hit: %v", err)
+		return nil, err
+	}
+	c.limiter.Update(resp.Header)
+	return resp, nil
+}
+
+// handle automatic token refresh. Refreshes run under the request's context.
 func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
+	accessToken, err := c.currentToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
 	// Add authorization header
-	if c.accessToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
+	if accessToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
 
 	// Handle token refresh if needed
 	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
 		log.Printf("Token expired, attempting refresh")
-		newTokens, err := c.RefreshToken()
+		newTokens, err := c.RefreshToken(req.Context())
 		if err != nil {
-			return nil, fmt.Errorf("token refresh failed: %v", err)
+			return nil, fmt.Errorf("token refresh failed: %w", err)
 		}
 
-		// Update tokens and retry request
-		c.accessToken = newTokens.AccessToken
-		c.refreshToken = newTokens.RefreshToken
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
-		return c.httpClient.Do(req)
+		// Rewind the body and retry the request with the new token
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error rewinding request body: %v", err)
+			}
+			req.Body = body
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", newTokens.AccessToken))
+		return c.send(req)
 	}
 
 	return resp, nil
 }
 
 // Update existing methods to use doRequest
-func (c *Client) GetAuthenticatedAthlete() (*Athlete, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/athlete", baseURL), nil)
+func (c *Client) GetAuthenticatedAthlete(ctx context.Context) (*Athlete, error) {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.apiURL+"/athlete", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -135,7 +410,7 @@ func (c *Client) GetAuthenticatedAthlete() (*Athlete, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to get athlete: %w", newAPIError(resp))
 	}
 
 	var athlete Athlete
@@ -146,7 +421,10 @@ func (c *Client) GetAuthenticatedAthlete() (*Athlete, error) {
 	return &athlete, nil
 }
 
-func (c *Client) GetAthleteActivities(page, perPage int, before, after int64) ([]Activity, error) {
+func (c *Client) GetAthleteActivities(ctx context.Context, page, perPage int, before, after int64) ([]Activity, error) {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
 	// Build query parameters
 	query := url.Values{}
 	query.Add("page", fmt.Sprintf("%d", page))
@@ -160,18 +438,15 @@ func (c *Client) GetAthleteActivities(page, perPage int, before, after int64) ([
 	}
 
 	// Create request
-	req, err := http.NewRequest("GET", activitiesURL+"?"+query.Encode(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.apiURL+"/athlete/activities?"+query.Encode(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
 
-	// Add authorization header
-	req.Header.Add("Authorization", "Bearer "+c.accessToken)
-
 	// Make the request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doRequest(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %v", err)
+		return nil, fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -183,7 +458,7 @@ func (c *Client) GetAthleteActivities(page, perPage int, before, after int64) ([
 
 	// Check for successful status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed: %s", string(body))
+		return nil, fmt.Errorf("failed to list activities: %w", parseAPIError(resp.StatusCode, body))
 	}
 
 	// Parse response
@@ -195,8 +470,11 @@ func (c *Client) GetAthleteActivities(page, perPage int, before, after int64) ([
 	return activities, nil
 }
 
-func (c *Client) UpdateActivity(activityID int64, name string) error {
-	updateURL := fmt.Sprintf("%s/activities/%d", baseURL, activityID)
+func (c *Client) UpdateActivity(ctx context.Context, activityID int64, name string) error {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
+	updateURL := fmt.Sprintf("%s/activities/%d", c.apiURL, activityID)
 
 	// Create request body
 	reqBody := UpdateActivityRequest{
@@ -209,39 +487,40 @@ func (c *Client) UpdateActivity(activityID int64, name string) error {
 	}
 
 	// Create request
-	req, err := http.NewRequest("PUT", updateURL, bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, "PUT", updateURL, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return fmt.Errorf("error creating request: %v", err)
 	}
 
 	// Add headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
 
 	// Make the request
 	resp, err := c.doRequest(req)
 	if err != nil {
-		return fmt.Errorf("error making request: %v", err)
+		return fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to update activity: status=%d, body=%s", resp.StatusCode, string(body))
+		return fmt.Errorf("failed to update activity: %w", newAPIError(resp))
 	}
 
 	return nil
 }
 
-func (c *Client) CreateWebhookSubscription(callbackURL, verifyToken string) (*WebhookSubscription, error) {
+func (c *Client) CreateWebhookSubscription(ctx context.Context, callbackURL, verifyToken string) (*WebhookSubscription, error) {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
 	data := url.Values{}
 	data.Set("client_id", c.clientID)
 	data.Set("client_secret", c.clientSecret)
 	data.Set("callback_url", callbackURL)
 	data.Set("verify_token", verifyToken)
 
-	req, err := http.NewRequest("POST", webhookSubscriptionURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL+"/push_subscriptions", strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
@@ -249,7 +528,7 @@ func (c *Client) CreateWebhookSubscription(callbackURL, verifyToken string) (*We
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	resp, err := c.doRequest(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %v", err)
+		return nil, fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -257,8 +536,7 @@ func (c *Client) CreateWebhookSubscription(callbackURL, verifyToken string) (*We
 	log.Printf("Create subscription response: Status=%d, Body=%s", resp.StatusCode, string(body))
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to create subscription: status=%d, body=%s",
-			resp.StatusCode, string(body))
+		return nil, fmt.Errorf("failed to create subscription: %w", parseAPIError(resp.StatusCode, body))
 	}
 
 	var subscription WebhookSubscription
@@ -269,10 +547,13 @@ func (c *Client) CreateWebhookSubscription(callbackURL, verifyToken string) (*We
 	return &subscription, nil
 }
 
-func (c *Client) GetActivity(activityID int64) (*Activity, error) {
-	url := fmt.Sprintf("%s/activities/%d", baseURL, activityID)
+func (c *Client) GetActivity(ctx context.Context, activityID int64) (*Activity, error) {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
 
-	req, err := http.NewRequest("GET", url, nil)
+	url := fmt.Sprintf("%s/activities/%d", c.apiURL, activityID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
@@ -284,8 +565,7 @@ func (c *Client) GetActivity(activityID int64) (*Activity, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get activity: status=%d, body=%s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("failed to get activity: %w", newAPIError(resp))
 	}
 
 	var activity Activity
@@ -296,9 +576,12 @@ func (c *Client) GetActivity(activityID int64) (*Activity, error) {
 	return &activity, nil
 }
 
-func (c *Client) ListWebhookSubscriptions() ([]WebhookSubscription, error) {
+func (c *Client) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
 	// Build URL with query parameters
-	u, err := url.Parse(webhookSubscriptionURL)
+	u, err := url.Parse(c.apiURL + "/push_subscriptions")
 	if err != nil {
 		return nil, err
 	}
@@ -309,14 +592,14 @@ func (c *Client) ListWebhookSubscriptions() ([]WebhookSubscription, error) {
 
 	log.Printf("Listing webhook subscriptions - URL: %s", u.String())
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
 
 	resp, err := c.doRequest(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %v", err)
+		return nil, fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -324,6 +607,10 @@ func (c *Client) ListWebhookSubscriptions() ([]WebhookSubscription, error) {
 	body, _ := io.ReadAll(resp.Body)
 	log.Printf("List subscriptions response: Status=%d, Body=%s", resp.StatusCode, string(body))
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", parseAPIError(resp.StatusCode, body))
+	}
+
 	// Create new reader for JSON decoder
 	resp.Body = io.NopCloser(bytes.NewBuffer(body))
 
@@ -335,48 +622,26 @@ func (c *Client) ListWebhookSubscriptions() ([]WebhookSubscription, error) {
 	return subscriptions, nil
 }
 
-func (c *Client) GetActivities() ([]Activity, error) {
-	req, err := http.NewRequest("GET", activitiesURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
-	}
-
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return nil, fmt.Errorf("error making request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status: %d, body: %s", resp.StatusCode, string(body))
-	}
+func (c *Client) DeleteWebhookSubscription(ctx context.Context, subscriptionID int64) error {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
 
-	var activities []Activity
-	if err := json.NewDecoder(resp.Body).Decode(&activities); err != nil {
-		return nil, fmt.Errorf("error decoding response: %v", err)
-	}
-
-	return activities, nil
-}
-
-func (c *Client) DeleteWebhookSubscription(subscriptionID int64) error {
 	// Build the URL with query parameters instead of form data
 	deleteURL := fmt.Sprintf("%s/%d?client_id=%s&client_secret=%s",
-		webhookSubscriptionURL,
+		c.apiURL+"/push_subscriptions",
 		subscriptionID,
 		c.clientID,
 		c.clientSecret)
 
-	req, err := http.NewRequest("DELETE", deleteURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", deleteURL, nil)
 	if err != nil {
 		return fmt.Errorf("error creating request: %v", err)
 	}
 
 	// Make the request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
-		return fmt.Errorf("error making request: %v", err)
+		return fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -386,8 +651,40 @@ func (c *Client) DeleteWebhookSubscription(subscriptionID int64) error {
 
 	// Consider both 204 (success) and 404 (already deleted) as success
 	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
-		return fmt.Errorf("failed to delete subscription: status=%d, body=%s",
-			resp.StatusCode, string(body))
+		return fmt.Errorf("failed to delete subscription: %w", parseAPIError(resp.StatusCode, body))
+	}
+
+	return nil
+}
+
+// Deauthorize revokes the application's access to the athlete's account.
+// All tokens issued to the app for this athlete become invalid.
+func (c *Client) Deauthorize(ctx context.Context) error {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
+	accessToken, err := c.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	data := url.Values{}
+	data.Set("access_token", accessToken)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.oauthURL+"/deauthorize", strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to deauthorize: %w", newAPIError(resp))
 	}
 
 	return nil
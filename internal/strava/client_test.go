@@ -0,0 +1,240 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.Handler, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	// Keep rate-limit state from leaking between tests and retry quickly
+	opts = append([]Option{
+		WithAPIURL(srv.URL + "/api/v3"),
+		WithOAuthURL(srv.URL + "/oauth"),
+		WithRateLimiter(NewRateLimiter()),
+		WithRetries(DefaultMaxAttempts, time.Millisecond),
+	}, opts...)
+	return NewClient("old-access", "old-refresh", "id", "secret", opts...)
+}
+
+func tokenHandler(t *testing.T, refreshes *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "refresh_token", r.Form.Get("grant_type"))
+		*refreshes++
+		json.NewEncoder(w).Encode(TokenResponse{
+			TokenType:    "Bearer",
+			AccessToken:  "new-access",
+			RefreshToken: "new-refresh",
+			ExpiresAt:    time.Now().Add(6 * time.Hour).Unix(),
+		})
+	}
+}
+
+func TestClient_RefreshesOnUnauthorizedAndPersists(t *testing.T) {
+	refreshes := 0
+	var persisted *TokenResponse
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", tokenHandler(t, &refreshes))
+	mux.HandleFunc("/api/v3/activities/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer new-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"name":"New name"}`, string(body), "body must survive the retry")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	c := newTestClient(t, mux, WithTokenRefreshFunc(func(ctx context.Context, tokens *TokenResponse) error {
+		persisted = tokens
+		return nil
+	}))
+
+	require.NoError(t, c.UpdateActivity(context.Background(), 1, "New name"))
+	assert.Equal(t, 1, refreshes)
+	require.NotNil(t, persisted)
+	assert.Equal(t, "new-refresh", persisted.RefreshToken)
+}
+
+func TestClient_RefreshesProactivelyBeforeExpiry(t *testing.T) {
+	refreshes := 0
+	persisted := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", tokenHandler(t, &refreshes))
+	mux.HandleFunc("/api/v3/athlete", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer new-access", r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(Athlete{ID: 7})
+	})
+
+	c := newTestClient(t, mux,
+		WithExpiresAt(time.Now().Add(time.Minute).Unix()),
+		WithTokenRefreshFunc(func(context.Context, *TokenResponse) error {
+			persisted++
+			return nil
+		}))
+
+	athlete, err := c.GetAuthenticatedAthlete(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), athlete.ID)
+
+	// The refreshed token is valid for hours, so no further refresh happens
+	_, err = c.GetAuthenticatedAthlete(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, 1, persisted)
+}
+
+func TestClient_Timeouts(t *testing.T) {
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/activities/1", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	t.Cleanup(func() { close(release) })
+
+	t.Run("client timeout", func(t *testing.T) {
+		c := newTestClient(t, mux, WithTimeout(20*time.Millisecond))
+
+		_, err := c.GetActivity(context.Background(), 1)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("caller cancellation", func(t *testing.T) {
+		c := newTestClient(t, mux, WithTimeout(0))
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		_, err := c.GetActivity(ctx, 1)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestClient_RateLimited(t *testing.T) {
+	calls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/activities/1", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Limit", "200,2000")
+		w.Header().Set("X-RateLimit-Usage", "201,900")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	limiter := NewRateLimiter()
+	c := newTestClient(t, mux, WithRateLimiter(limiter))
+
+	_, err := c.GetActivity(context.Background(), 1)
+	require.ErrorIs(t, err, ErrRateLimited)
+	var limited *RateLimitError
+	require.ErrorAs(t, err, &limited)
+	assert.True(t, limited.RetryAfter.After(time.Now()))
+	assert.Equal(t, 201, limiter.Status().Overall.ShortTermUsage)
+
+	// Until the window resets no further request reaches Strava
+	err = c.UpdateActivity(context.Background(), 1, "New name")
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, 1, calls)
+}
+
+func TestClient_APIError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/push_subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"Bad Request","errors":[{"resource":"PushSubscription","field":"","code":"already exists"}]}`))
+	})
+	mux.HandleFunc("/api/v3/activities/1", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not json"))
+	})
+	c := newTestClient(t, mux)
+
+	_, err := c.CreateWebhookSubscription(context.Background(), "https://example.com/webhook", "verify")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "Bad Request", apiErr.Message)
+	assert.True(t, apiErr.HasCode("already exists"))
+	assert.False(t, apiErr.Retryable())
+
+	_, err = c.GetActivity(context.Background(), 1)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "not json", apiErr.Body)
+}
+
+func TestClient_RetriesServerErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		call          func(c *Client) error
+		failures      int
+		expectedCalls int
+		expectErr     bool
+	}{
+		{
+			name:          "idempotent call recovers",
+			call:          func(c *Client) error { _, err := c.GetActivity(context.Background(), 1); return err },
+			failures:      2,
+			expectedCalls: 3,
+		},
+		{
+			name:          "idempotent call gives up",
+			call:          func(c *Client) error { return c.UpdateActivity(context.Background(), 1, "New name") },
+			failures:      5,
+			expectedCalls: DefaultMaxAttempts,
+			expectErr:     true,
+		},
+		{
+			name:          "non-idempotent call is not retried",
+			call:          func(c *Client) error { return c.Deauthorize(context.Background()) },
+			failures:      1,
+			expectedCalls: 1,
+			expectErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls <= tt.failures {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				if r.Method == http.MethodPut {
+					body, _ := io.ReadAll(r.Body)
+					assert.JSONEq(t, `{"name":"New name"}`, string(body), "body must survive the retry")
+				}
+				json.NewEncoder(w).Encode(Activity{ID: 1})
+			})
+			c := newTestClient(t, handler)
+
+			err := tt.call(c)
+			assert.Equal(t, tt.expectedCalls, calls)
+			if !tt.expectErr {
+				require.NoError(t, err)
+				return
+			}
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+			assert.True(t, apiErr.Retryable())
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package strava
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody bounds how much of an error response is kept
+const maxErrorBody = 4 << 10
+
+// ErrorDetail is one entry of the errors list in a Strava error response,
+// for example {"resource": "PushSubscription", "field": "callback url",
+// "code": "already exists"}.
+type ErrorDetail struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Code     string `json:"code"`
+}
+
+// APIError is returned when Strava answers with an unexpected status
+type APIError struct {
+	StatusCode int
+	Message    string
+	Errors     []ErrorDetail
+	// Body is the raw response when it was not a Strava error document
+	Body string
+}
+
+// newAPIError builds an APIError from a response, consuming its body
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return parseAPIError(resp.StatusCode, body)
+}
+
+// parseAPIError builds an APIError from a response body already read
+func parseAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode}
+	var doc struct {
+		Message string        `json:"message"`
+		Errors  []ErrorDetail `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &doc); err == nil && (doc.Message != "" || len(doc.Errors) > 0) {
+		apiErr.Message = doc.Message
+		apiErr.Errors = doc.Errors
+	} else {
+		if len(body) > maxErrorBody {
+			body = body[:maxErrorBody]
+		}
+		apiErr.Body = string(body)
+	}
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "strava API error: status=%d", e.StatusCode)
+	if e.Message != "" {
+		fmt.Fprintf(&b, ", message=%s", e.Message)
+	}
+	for _, d := range e.Errors {
+		fmt.Fprintf(&b, ", %s %s: %s", d.Resource, d.Field, d.Code)
+	}
+	if e.Body != "" {
+		fmt.Fprintf(&b, ", body=%s", e.Body)
+	}
+	return b.String()
+}
+
+// Retryable reports whether sending the same request again may succeed.
+// Server errors are transient; client errors will fail the same way.
+// Rate limiting is reported as a RateLimitError instead.
+func (e *APIError) Retryable() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+func retryableStatus(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusRequestTimeout
+}
+
+// HasCode reports whether Strava returned an error entry with the given code
+func (e *APIError) HasCode(code string) bool {
+	for _, d := range e.Errors {
+		if d.Code == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package strava
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// shortTermWindow is Strava's short rate-limit window. Windows start at
+	// 0, 15, 30 and 45 minutes past the hour; the daily one at midnight UTC.
+	shortTermWindow = 15 * time.Minute
+
+	// rateLimitHeadroom is the share of each limit left unused, so requests
+	// already in flight and other clients of the app do not push us over
+	rateLimitHeadroom = 0.05
+)
+
+// ErrRateLimited matches every RateLimitError with errors.Is
+var ErrRateLimited = errors.New("strava rate limit reached")
+
+// RateLimitError is returned when a request was refused by Strava with 429,
+// or was not sent because it would have exceeded the app's rate limit.
+type RateLimitError struct {
+	RetryAfter time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrRateLimited, e.RetryAfter.Format(time.RFC3339))
+}
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
+
+// RateLimitUsage is the app's usage of one Strava limit. A zero limit means
+// Strava has not reported it yet.
+type RateLimitUsage struct {
+	ShortTermLimit int `json:"short_term_limit"`
+	ShortTermUsage int `json:"short_term_usage"`
+	DailyLimit     int `json:"daily_limit"`
+	DailyUsage     int `json:"daily_usage"`
+}
+
+// RateLimitStatus is a snapshot of the rate-limit state
+type RateLimitStatus struct {
+	// Overall counts every request, Read only the GET requests
+	Overall      RateLimitUsage `json:"overall"`
+	Read         RateLimitUsage `json:"read"`
+	UpdatedAt    time.Time      `json:"updated_at,omitempty"`
+	LimitedUntil time.Time      `json:"limited_until,omitempty"`
+}
+
+// RateLimiter tracks the app's Strava rate limits from the X-RateLimit-*
+// headers. Strava limits the application as a whole, so one RateLimiter is
+// shared by every client.
+type RateLimiter struct {
+	mu     sync.Mutex
+	status RateLimitStatus
+	// seen is when the usage was last brought up to date
+	seen time.Time
+	now  func() time.Time
+}
+
+// DefaultRateLimiter is used by clients created without WithRateLimiter
+var DefaultRateLimiter = NewRateLimiter()
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{now: time.Now}
+}
+
+// Status returns the current usage
+func (l *RateLimiter) Status() RateLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expireLocked(l.now())
+	return l.status
+}
+
+// Reserve accounts for a request about to be sent, or returns a
+// *RateLimitError if it would take usage past the headroom.
+func (l *RateLimiter) Reserve(read bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.expireLocked(now)
+
+	if now.Before(l.status.LimitedUntil) {
+		return &RateLimitError{RetryAfter: l.status.LimitedUntil}
+	}
+
+	usages := []*RateLimitUsage{&l.status.Overall}
+	if read {
+		usages = append(usages, &l.status.Read)
+	}
+	for _, u := range usages {
+		if retry, full := u.full(now); full {
+			return &RateLimitError{RetryAfter: retry}
+		}
+	}
+
+	// Count the request now; the response headers will correct the totals
+	for _, u := range usages {
+		u.ShortTermUsage++
+		u.DailyUsage++
+	}
+	return nil
+}
+
+// Update records the usage reported in a response's headers
+func (l *RateLimiter) Update(header http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.updateLocked(header)
+}
+
+// Limited records a 429 response and returns the error to hand to the caller
+func (l *RateLimiter) Limited(header http.Header) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.updateLocked(header)
+
+	// Prefer Strava's own hint, then whichever window is exhausted
+	retry := shortTermReset(now)
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		retry = now.Add(time.Duration(seconds) * time.Second)
+	} else {
+		for _, u := range []RateLimitUsage{l.status.Overall, l.status.Read} {
+			if u.DailyLimit > 0 && u.DailyUsage >= u.DailyLimit {
+				retry = dailyReset(now)
+			}
+		}
+	}
+
+	l.status.LimitedUntil = retry
+	return &RateLimitError{RetryAfter: retry}
+}
+
+func (l *RateLimiter) updateLocked(header http.Header) {
+	updated := false
+	if limits, usage, ok := parseRateLimit(header, "X-RateLimit"); ok {
+		l.status.Overall = RateLimitUsage{limits[0], usage[0], limits[1], usage[1]}
+		updated = true
+	}
+	if limits, usage, ok := parseRateLimit(header, "X-ReadRateLimit"); ok {
+		l.status.Read = RateLimitUsage{limits[0], usage[0], limits[1], usage[1]}
+		updated = true
+	}
+	if updated {
+		l.status.UpdatedAt = l.now()
+		l.seen = l.status.UpdatedAt
+	}
+}
+
+// expireLocked zeroes the usage of windows that ended since the last update
+func (l *RateLimiter) expireLocked(now time.Time) {
+	last := l.seen
+	l.seen = now
+	if last.IsZero() {
+		return
+	}
+	if !last.Truncate(shortTermWindow).Equal(now.Truncate(shortTermWindow)) {
+		l.status.Overall.ShortTermUsage = 0
+		l.status.Read.ShortTermUsage = 0
+	}
+	if !dailyReset(last).Equal(dailyReset(now)) {
+		l.status.Overall.DailyUsage = 0
+		l.status.Read.DailyUsage = 0
+	}
+}
+
+// full reports whether another request would eat into the headroom, and
+// when the exhausted window resets
+func (u RateLimitUsage) full(now time.Time) (time.Time, bool) {
+	if u.DailyLimit > 0 && u.DailyUsage >= usable(u.DailyLimit) {
+		return dailyReset(now), true
+	}
+	if u.ShortTermLimit > 0 && u.ShortTermUsage >= usable(u.ShortTermLimit) {
+		return shortTermReset(now), true
+	}
+	return time.Time{}, false
+}
+
+func usable(limit int) int {
+	return limit - int(float64(limit)*rateLimitHeadroom)
+}
+
+func shortTermReset(now time.Time) time.Time {
+	return now.UTC().Truncate(shortTermWindow).Add(shortTermWindow)
+}
+
+func dailyReset(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// parseRateLimit reads a "<15 minute>,<daily>" pair from the
+// <prefix>-Limit and <prefix>-Usage headers
+func parseRateLimit(header http.Header, prefix string) (limits, usage [2]int, ok bool) {
+	limits, ok = parsePair(header.Get(prefix + "-Limit"))
+	if !ok {
+		return limits, usage, false
+	}
+	usage, ok = parsePair(header.Get(prefix + "-Usage"))
+	return limits, usage, ok
+}
+
+func parsePair(value string) ([2]int, bool) {
+	var pair [2]int
+	short, daily, found := strings.Cut(value, ",")
+	if !found {
+		return pair, false
+	}
+	var err error
+	if pair[0], err = strconv.Atoi(strings.TrimSpace(short)); err != nil {
+		return pair, false
+	}
+	if pair[1], err = strconv.Atoi(strings.TrimSpace(daily)); err != nil {
+		return pair, false
+	}
+	return pair, true
+}
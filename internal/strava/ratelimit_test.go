@@ -0,0 +1,111 @@
+package strava
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rateLimitHeaders(limit, usage string) http.Header {
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", limit)
+	h.Set("X-RateLimit-Usage", usage)
+	return h
+}
+
+func newTestRateLimiter(now *time.Time) *RateLimiter {
+	l := NewRateLimiter()
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestRateLimiter_ParsesHeaders(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 3, 0, 0, time.UTC)
+	l := newTestRateLimiter(&now)
+
+	h := rateLimitHeaders("200,2000", "12,340")
+	h.Set("X-ReadRateLimit-Limit", "100, 1000")
+	h.Set("X-ReadRateLimit-Usage", "8, 300")
+	l.Update(h)
+
+	status := l.Status()
+	assert.Equal(t, RateLimitUsage{ShortTermLimit: 200, ShortTermUsage: 12, DailyLimit: 2000, DailyUsage: 340}, status.Overall)
+	assert.Equal(t, RateLimitUsage{ShortTermLimit: 100, ShortTermUsage: 8, DailyLimit: 1000, DailyUsage: 300}, status.Read)
+	assert.Equal(t, now, status.UpdatedAt)
+
+	// Malformed headers leave the state alone
+	l.Update(rateLimitHeaders("200", "garbage"))
+	assert.Equal(t, 12, l.Status().Overall.ShortTermUsage)
+}
+
+func TestRateLimiter_BacksOffBeforeTheLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		usage   string
+		retryAt time.Time
+	}{
+		{name: "short-term window", usage: "190,500", retryAt: time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)},
+		{name: "daily window", usage: "10,1900", retryAt: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2024, 5, 1, 10, 3, 0, 0, time.UTC)
+			l := newTestRateLimiter(&now)
+			l.Update(rateLimitHeaders("200,2000", tt.usage))
+
+			err := l.Reserve(false)
+			require.ErrorIs(t, err, ErrRateLimited)
+			var limited *RateLimitError
+			require.ErrorAs(t, err, &limited)
+			assert.Equal(t, tt.retryAt, limited.RetryAfter)
+		})
+	}
+}
+
+func TestRateLimiter_CountsReservationsAndResetsWindows(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 3, 0, 0, time.UTC)
+	l := newTestRateLimiter(&now)
+	l.Update(rateLimitHeaders("200,2000", "188,1000"))
+
+	// 190 is the last usable request with 5% headroom
+	require.NoError(t, l.Reserve(false))
+	require.NoError(t, l.Reserve(false))
+	require.ErrorIs(t, l.Reserve(false), ErrRateLimited)
+
+	now = now.Add(15 * time.Minute)
+	require.NoError(t, l.Reserve(false))
+	status := l.Status()
+	assert.Equal(t, 1, status.Overall.ShortTermUsage)
+	assert.Equal(t, 1003, status.Overall.DailyUsage)
+
+	now = now.Add(24 * time.Hour)
+	assert.Equal(t, 0, l.Status().Overall.DailyUsage)
+}
+
+func TestRateLimiter_Limited(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 3, 0, 0, time.UTC)
+
+	t.Run("retry-after header", func(t *testing.T) {
+		l := newTestRateLimiter(&now)
+		h := rateLimitHeaders("200,2000", "200,900")
+		h.Set("Retry-After", "90")
+
+		var limited *RateLimitError
+		require.ErrorAs(t, l.Limited(h), &limited)
+		assert.Equal(t, now.Add(90*time.Second), limited.RetryAfter)
+		assert.Equal(t, limited.RetryAfter, l.Status().LimitedUntil)
+		require.ErrorIs(t, l.Reserve(true), ErrRateLimited)
+	})
+
+	t.Run("daily limit exhausted", func(t *testing.T) {
+		l := newTestRateLimiter(&now)
+
+		var limited *RateLimitError
+		require.ErrorAs(t, l.Limited(rateLimitHeaders("200,2000", "50,2000")), &limited)
+		assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), limited.RetryAfter)
+	})
+}
@@ -0,0 +1,218 @@
+package stravatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+)
+
+func (s *Server) handleAthlete(w http.ResponseWriter, r *http.Request, athlete *strava.Athlete) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, athlete)
+}
+
+// handleListActivities serves the athlete's activities newest first, with
+// Strava's page, per_page, before and after parameters
+func (s *Server) handleListActivities(w http.ResponseWriter, r *http.Request, athlete *strava.Athlete) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	page, err := intQuery(query.Get("page"), 1)
+	if err != nil || page < 1 {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Activity", "page", "invalid")
+		return
+	}
+	perPage, err := intQuery(query.Get("per_page"), 30)
+	if err != nil || perPage < 1 || perPage > 200 {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Activity", "per_page", "invalid")
+		return
+	}
+	before, err := intQuery(query.Get("before"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Activity", "before", "invalid")
+		return
+	}
+	after, err := intQuery(query.Get("after"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Activity", "after", "invalid")
+		return
+	}
+
+	s.mu.Lock()
+	activities := []strava.Activity{}
+	for id, activity := range s.activities {
+		start := activity.StartDate.Unix()
+		if s.owners[id] != athlete.ID || (before != 0 && start >= int64(before)) || (after != 0 && start <= int64(after)) {
+			continue
+		}
+		activities = append(activities, *activity)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(activities, func(i, j int) bool {
+		if activities[i].StartDate.Equal(activities[j].StartDate) {
+			return activities[i].ID > activities[j].ID
+		}
+		return activities[i].StartDate.After(activities[j].StartDate)
+	})
+
+	start := (page - 1) * perPage
+	if start > len(activities) {
+		start = len(activities)
+	}
+	end := start + perPage
+	if end > len(activities) {
+		end = len(activities)
+	}
+	writeJSON(w, http.StatusOK, activities[start:end])
+}
+
+// handleActivity serves GET and PUT /activities/{id}. Only the name can be
+// updated.
+func (s *Server) handleActivity(w http.ResponseWriter, r *http.Request, athlete *strava.Athlete) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v3/activities/"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Record Not Found", "Activity", "id", "invalid")
+		return
+	}
+
+	var update strava.UpdateActivityRequest
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request", "Activity", "body", "invalid")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	activity, ok := s.activities[id]
+	if !ok || s.owners[id] != athlete.ID {
+		writeError(w, http.StatusNotFound, "Record Not Found", "Activity", "id", "invalid")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if update.Name != "" {
+			activity.Name = update.Name
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, activity)
+}
+
+// handleSubscriptions lists the app's push subscriptions or creates one.
+// Like Strava, creating one first validates the callback URL and only a
+// single subscription per app is allowed.
+func (s *Server) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		subs := s.subscriptionsLocked()
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, subs)
+
+	case http.MethodPost:
+		callbackURL := r.Form.Get("callback_url")
+		verifyToken := r.Form.Get("verify_token")
+
+		s.mu.Lock()
+		exists := len(s.subscriptions) > 0
+		s.mu.Unlock()
+		if exists {
+			writeError(w, http.StatusBadRequest, "Bad Request", "PushSubscription", "", "already exists")
+			return
+		}
+
+		if err := s.validateCallback(r, callbackURL, verifyToken); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request", "PushSubscription", "callback url", err.Error())
+			return
+		}
+
+		s.mu.Lock()
+		sub := &strava.WebhookSubscription{
+			ID:            s.newIDLocked(),
+			ApplicationID: 1,
+			CallbackURL:   callbackURL,
+		}
+		s.subscriptions[sub.ID] = sub
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, map[string]int64{"id": sub.ID})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSubscription serves DELETE /push_subscriptions/{id}
+func (s *Server) handleSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v3/push_subscriptions/"), 10, 64)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscriptions[id]; err != nil || !ok {
+		writeError(w, http.StatusNotFound, "Resource Not Found", "PushSubscription", "id", "not found")
+		return
+	}
+	delete(s.subscriptions, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateCallback sends the subscription challenge to the callback URL and
+// checks it is echoed back
+func (s *Server) validateCallback(r *http.Request, callbackURL, verifyToken string) error {
+	challenge := newToken()
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, callbackURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid")
+	}
+	query := req.URL.Query()
+	query.Set("hub.mode", "subscribe")
+	query.Set("hub.challenge", challenge)
+	query.Set("hub.verify_token", verifyToken)
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := s.CallbackClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("not verifiable")
+	}
+	defer resp.Body.Close()
+
+	var body map[string]string
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET to callback URL does not return 200")
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body["hub.challenge"] != challenge {
+		return fmt.Errorf("challenge not echoed")
+	}
+	return nil
+}
+
+func intQuery(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,83 @@
+package stravatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Event is a push subscription event as Strava delivers it
+type Event struct {
+	ObjectType     string                 `json:"object_type"`
+	ObjectID       int64                  `json:"object_id"`
+	AspectType     string                 `json:"aspect_type"`
+	OwnerID        int64                  `json:"owner_id"`
+	SubscriptionID int64                  `json:"subscription_id"`
+	EventTime      int64                  `json:"event_time"`
+	Updates        map[string]interface{} `json:"updates"`
+}
+
+// ActivityCreated is the event for a newly uploaded activity
+func ActivityCreated(athleteID, activityID int64) Event {
+	return Event{
+		ObjectType: "activity",
+		ObjectID:   activityID,
+		AspectType: "create",
+		OwnerID:    athleteID,
+		EventTime:  time.Now().Unix(),
+		Updates:    map[string]interface{}{},
+	}
+}
+
+// Deauthorized is the event for an athlete revoking the app on strava.com
+func Deauthorized(athleteID int64) Event {
+	return Event{
+		ObjectType: "athlete",
+		ObjectID:   athleteID,
+		AspectType: "update",
+		OwnerID:    athleteID,
+		EventTime:  time.Now().Unix(),
+		Updates:    map[string]interface{}{"authorized": "false"},
+	}
+}
+
+// SendEvent posts an event to callbackURL and fails unless it is answered
+// with 200, which is what Strava needs to consider it delivered
+func (s *Server) SendEvent(ctx context.Context, callbackURL string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.CallbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("event not accepted: status=%d, body=%s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// Notify delivers an event through the app's push subscription, the way
+// Strava would
+func (s *Server) Notify(ctx context.Context, event Event) error {
+	subs := s.Subscriptions()
+	if len(subs) == 0 {
+		return fmt.Errorf("no push subscription to deliver to")
+	}
+	event.SubscriptionID = subs[0].ID
+	return s.SendEvent(ctx, subs[0].CallbackURL, event)
+}
@@ -0,0 +1,164 @@
+package stravatest
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+)
+
+// handleAuthorize stands in for the approval page: the athlete set with
+// LoginAs approves at once and is sent back to redirect_uri with a code
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != ClientID {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Application", "client_id", "invalid")
+		return
+	}
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Application", "redirect_uri", "invalid")
+		return
+	}
+
+	s.mu.Lock()
+	athleteID := s.loginAs
+	code := newToken()
+	if athleteID != 0 {
+		s.codes[code] = athleteID
+	}
+	s.mu.Unlock()
+
+	values := redirect.Query()
+	if athleteID == 0 {
+		values.Set("error", "access_denied")
+	} else {
+		values.Set("code", code)
+		values.Set("scope", query.Get("scope"))
+	}
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// handleToken exchanges authorization codes and refresh tokens
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", "", "", "")
+		return
+	}
+	if r.Form.Get("client_id") != ClientID || r.Form.Get("client_secret") != ClientSecret {
+		writeError(w, http.StatusUnauthorized, "Bad Request", "Application", "client_id", "invalid")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var athleteID int64
+	var ok bool
+	switch r.Form.Get("grant_type") {
+	case "authorization_code":
+		code := r.Form.Get("code")
+		athleteID, ok = s.codes[code]
+		delete(s.codes, code)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Bad Request", "AuthorizationCode", "code", "invalid")
+			return
+		}
+	case "refresh_token":
+		refresh := r.Form.Get("refresh_token")
+		athleteID, ok = s.refreshTokens[refresh]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Bad Request", "RefreshToken", "refresh_token", "invalid")
+			return
+		}
+		// Strava may rotate the refresh token; this fake always does
+		delete(s.refreshTokens, refresh)
+	default:
+		writeError(w, http.StatusBadRequest, "Bad Request", "", "grant_type", "invalid")
+		return
+	}
+
+	access, refresh := newToken(), newToken()
+	expiresAt := time.Now().Add(tokenLifetime)
+	s.accessTokens[access] = token{athleteID: athleteID, expiresAt: expiresAt}
+	s.refreshTokens[refresh] = athleteID
+
+	resp := map[string]interface{}{
+		"token_type":    "Bearer",
+		"access_token":  access,
+		"refresh_token": refresh,
+		"expires_at":    expiresAt.Unix(),
+		"expires_in":    int(tokenLifetime.Seconds()),
+	}
+	if r.Form.Get("grant_type") == "authorization_code" {
+		resp["athlete"] = s.athletes[athleteID]
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDeauthorize revokes every token of the athlete
+func (s *Server) handleDeauthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	access := r.Form.Get("access_token")
+	if access == "" {
+		access = bearerToken(r)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.accessTokens[access]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authorization Error", "Athlete", "access_token", "invalid")
+		return
+	}
+	s.revokeLocked(t.athleteID)
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": access})
+}
+
+// requireToken resolves the bearer token to an athlete
+func (s *Server) requireToken(next func(http.ResponseWriter, *http.Request, *strava.Athlete)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		t, ok := s.accessTokens[bearerToken(r)]
+		athlete := s.athletes[t.athleteID]
+		s.mu.Unlock()
+
+		if !ok || time.Now().After(t.expiresAt) || athlete == nil {
+			writeError(w, http.StatusUnauthorized, "Authorization Error", "Athlete", "access_token", "invalid")
+			return
+		}
+		next(w, r, athlete)
+	}
+}
+
+// requireApp checks the app credentials push subscription calls carry
+func (s *Server) requireApp(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request", "", "", "")
+			return
+		}
+		if r.Form.Get("client_id") != ClientID || r.Form.Get("client_secret") != ClientSecret {
+			writeError(w, http.StatusUnauthorized, "Authorization Error", "Application", "client_id", "invalid")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
@@ -0,0 +1,325 @@
+// Package stravatest provides a fake Strava for end-to-end tests. It serves
+// the OAuth flow, the parts of the API the app uses and push subscriptions
+// from memory, can deliver webhook events and can be told to fail requests.
+package stravatest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+)
+
+const (
+	// ClientID and ClientSecret are the app credentials the server accepts
+	ClientID     = "12345"
+	ClientSecret = "stravatest-secret"
+
+	// tokenLifetime matches the six hours Strava access tokens are valid
+	tokenLifetime = 6 * time.Hour
+)
+
+// Failure makes matching requests fail with Status instead of being served
+type Failure struct {
+	// Method and Path select the requests, for example "PUT" and
+	// "/api/v3/activities/1". Empty values match anything.
+	Method string
+	Path   string
+	Status int
+	// Times is how many requests fail; zero means one
+	Times int
+}
+
+type token struct {
+	athleteID int64
+	expiresAt time.Time
+}
+
+// Server is a fake Strava. Its zero value is not usable; create one with
+// NewServer and Close it when done.
+type Server struct {
+	*httptest.Server
+
+	// CallbackClient makes the requests to the app: subscription
+	// validation and webhook events. It defaults to http.DefaultClient and
+	// must trust the app's certificate when the app is served over TLS.
+	CallbackClient *http.Client
+
+	mu            sync.Mutex
+	athletes      map[int64]*strava.Athlete
+	activities    map[int64]*strava.Activity
+	owners        map[int64]int64
+	loginAs       int64
+	codes         map[string]int64
+	accessTokens  map[string]token
+	refreshTokens map[string]int64
+	subscriptions map[int64]*strava.WebhookSubscription
+	failures      []*Failure
+	requests      map[string]int
+	nextID        int64
+	usage         [2]int
+	readUsage     [2]int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		athletes:       make(map[int64]*strava.Athlete),
+		activities:     make(map[int64]*strava.Activity),
+		owners:         make(map[int64]int64),
+		codes:          make(map[string]int64),
+		accessTokens:   make(map[string]token),
+		refreshTokens:  make(map[string]int64),
+		subscriptions:  make(map[int64]*strava.WebhookSubscription),
+		requests:       make(map[string]int),
+		nextID:         1000,
+		CallbackClient: http.DefaultClient,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize", s.handleAuthorize)
+	mux.HandleFunc("/oauth/token", s.handleToken)
+	mux.HandleFunc("/oauth/deauthorize", s.handleDeauthorize)
+	mux.HandleFunc("/api/v3/athlete", s.requireToken(s.handleAthlete))
+	mux.HandleFunc("/api/v3/athlete/activities", s.requireToken(s.handleListActivities))
+	mux.HandleFunc("/api/v3/activities/", s.requireToken(s.handleActivity))
+	mux.HandleFunc("/api/v3/push_subscriptions", s.requireApp(s.handleSubscriptions))
+	mux.HandleFunc("/api/v3/push_subscriptions/", s.requireApp(s.handleSubscription))
+
+	s.Server = httptest.NewServer(s.intercept(mux))
+	return s
+}
+
+// APIURL is the base URL of the fake API, for strava.WithAPIURL
+func (s *Server) APIURL() string {
+	return s.URL + "/api/v3"
+}
+
+// OAuthURL is the base URL of the fake OAuth endpoints, for
+// strava.WithOAuthURL
+func (s *Server) OAuthURL() string {
+	return s.URL + "/oauth"
+}
+
+// AddAthlete registers an athlete. The first athlete added is the one who
+// approves the app on /oauth/authorize until LoginAs says otherwise.
+func (s *Server) AddAthlete(athlete strava.Athlete) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.athletes[athlete.ID] = &athlete
+	if s.loginAs == 0 {
+		s.loginAs = athlete.ID
+	}
+}
+
+// LoginAs sets the athlete who approves the app on /oauth/authorize
+func (s *Server) LoginAs(athleteID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loginAs = athleteID
+}
+
+// AddActivity stores an activity for the athlete and returns it. An ID is
+// assigned when the activity has none.
+func (s *Server) AddActivity(athleteID int64, activity strava.Activity) strava.Activity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if activity.ID == 0 {
+		activity.ID = s.newIDLocked()
+	}
+	if activity.StartDate.IsZero() {
+		activity.StartDate = time.Now().UTC()
+	}
+	s.activities[activity.ID] = &activity
+	s.owners[activity.ID] = athleteID
+	return activity
+}
+
+// Activity returns the current state of an activity
+func (s *Server) Activity(id int64) (strava.Activity, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity, ok := s.activities[id]
+	if !ok {
+		return strava.Activity{}, false
+	}
+	return *activity, true
+}
+
+// Subscriptions returns the app's push subscriptions
+func (s *Server) Subscriptions() []strava.WebhookSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptionsLocked()
+}
+
+// ExpireAccessTokens invalidates the athlete's access tokens, so the next
+// API call gets a 401 and has to refresh
+func (s *Server) ExpireAccessTokens(athleteID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, t := range s.accessTokens {
+		if t.athleteID == athleteID {
+			delete(s.accessTokens, key)
+		}
+	}
+}
+
+// Revoke revokes every token of the athlete, as when the athlete removes
+// the app on strava.com
+func (s *Server) Revoke(athleteID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokeLocked(athleteID)
+}
+
+func (s *Server) revokeLocked(athleteID int64) {
+	for key, t := range s.accessTokens {
+		if t.athleteID == athleteID {
+			delete(s.accessTokens, key)
+		}
+	}
+	for key, id := range s.refreshTokens {
+		if id == athleteID {
+			delete(s.refreshTokens, key)
+		}
+	}
+}
+
+// Authorized reports whether the athlete has granted the app access that
+// has not been revoked
+func (s *Server) Authorized(athleteID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.refreshTokens {
+		if id == athleteID {
+			return true
+		}
+	}
+	return false
+}
+
+// InjectFailure makes the next matching requests fail
+func (s *Server) InjectFailure(f Failure) {
+	if f.Times <= 0 {
+		f.Times = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &f)
+}
+
+// Requests returns how many requests were made to method and path,
+// including failed ones
+func (s *Server) Requests(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method+" "+path]
+}
+
+// intercept counts requests, serves injected failures and reports rate-limit
+// usage on API responses
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.Method+" "+r.URL.Path]++
+		failure := s.takeFailureLocked(r)
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			s.countUsageLocked(w, r, failure)
+		}
+		s.mu.Unlock()
+
+		if failure == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch failure.Status {
+		case http.StatusUnauthorized:
+			writeError(w, http.StatusUnauthorized, "Authorization Error", "Athlete", "access_token", "invalid")
+		case http.StatusTooManyRequests:
+			writeError(w, http.StatusTooManyRequests, "Rate Limit Exceeded", "", "", "")
+		default:
+			writeError(w, failure.Status, http.StatusText(failure.Status), "", "", "")
+		}
+	})
+}
+
+func (s *Server) takeFailureLocked(r *http.Request) *Failure {
+	for i, f := range s.failures {
+		if (f.Method == "" || f.Method == r.Method) && (f.Path == "" || f.Path == r.URL.Path) {
+			f.Times--
+			if f.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+			return f
+		}
+	}
+	return nil
+}
+
+// countUsageLocked sets the X-RateLimit headers, using Strava's default
+// limits. An injected 429 reports the limits as exhausted.
+func (s *Server) countUsageLocked(w http.ResponseWriter, r *http.Request, failure *Failure) {
+	limits, readLimits := [2]int{200, 2000}, [2]int{100, 1000}
+
+	s.usage[0]++
+	s.usage[1]++
+	if r.Method == http.MethodGet {
+		s.readUsage[0]++
+		s.readUsage[1]++
+	}
+	usage, readUsage := s.usage, s.readUsage
+	if failure != nil && failure.Status == http.StatusTooManyRequests {
+		usage, readUsage = limits, readLimits
+	}
+
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", fmt.Sprintf("%d,%d", limits[0], limits[1]))
+	h.Set("X-RateLimit-Usage", fmt.Sprintf("%d,%d", usage[0], usage[1]))
+	h.Set("X-ReadRateLimit-Limit", fmt.Sprintf("%d,%d", readLimits[0], readLimits[1]))
+	h.Set("X-ReadRateLimit-Usage", fmt.Sprintf("%d,%d", readUsage[0], readUsage[1]))
+}
+
+func (s *Server) newIDLocked() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) subscriptionsLocked() []strava.WebhookSubscription {
+	subs := make([]strava.WebhookSubscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers in the shape of Strava's error documents
+func writeError(w http.ResponseWriter, status int, message, resource, field, code string) {
+	doc := map[string]interface{}{"message": message, "errors": []strava.ErrorDetail{}}
+	if code != "" {
+		doc["errors"] = []strava.ErrorDetail{{Resource: resource, Field: field, Code: code}}
+	}
+	writeJSON(w, status, doc)
+}
@@ -0,0 +1,141 @@
+package stravatest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/guisithos/go-ride-names/internal/strava"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newClient logs athleteID in through the fake's token endpoint and returns
+// a client using the tokens
+func newClient(t *testing.T, s *Server, athleteID int64) *strava.Client {
+	t.Helper()
+	s.mu.Lock()
+	refresh := newToken()
+	s.refreshTokens[refresh] = athleteID
+	s.mu.Unlock()
+
+	return strava.NewClient("", refresh, ClientID, ClientSecret,
+		strava.WithAPIURL(s.APIURL()),
+		strava.WithOAuthURL(s.OAuthURL()),
+		strava.WithExpiresAt(1),
+		strava.WithRateLimiter(strava.NewRateLimiter()),
+		strava.WithRetries(strava.DefaultMaxAttempts, time.Millisecond))
+}
+
+func TestServer_ActivitiesArePaginatedNewestFirst(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddAthlete(strava.Athlete{ID: 1})
+	s.AddAthlete(strava.Athlete{ID: 2})
+
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		s.AddActivity(1, strava.Activity{ID: int64(i + 1), Name: "Morning Run", StartDate: start.Add(time.Duration(i) * time.Hour)})
+	}
+	s.AddActivity(2, strava.Activity{ID: 99, Name: "Someone else's run", StartDate: start})
+
+	c := newClient(t, s, 1)
+	ctx := context.Background()
+
+	page1, err := c.GetAthleteActivities(ctx, 1, 2, 0, 0)
+	require.NoError(t, err)
+	page3, err := c.GetAthleteActivities(ctx, 3, 2, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{5, 4}, activityIDs(page1))
+	assert.Equal(t, []int64{1}, activityIDs(page3))
+
+	window, err := c.GetAthleteActivities(ctx, 1, 10, start.Add(3*time.Hour).Unix(), start.Unix())
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 2}, activityIDs(window))
+
+	_, err = c.GetActivity(ctx, 99)
+	var apiErr *strava.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestServer_InjectedFailures(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddAthlete(strava.Athlete{ID: 1})
+	activity := s.AddActivity(1, strava.Activity{Name: "Morning Run"})
+	path := "/api/v3/activities/" + strconv.FormatInt(activity.ID, 10)
+
+	c := newClient(t, s, 1)
+	ctx := context.Background()
+
+	// A 401 is answered with a refresh and a retry
+	_, err := c.GetActivity(ctx, activity.ID)
+	require.NoError(t, err)
+	s.InjectFailure(Failure{Method: http.MethodPut, Path: path, Status: http.StatusUnauthorized})
+	require.NoError(t, c.UpdateActivity(ctx, activity.ID, "Renamed"))
+	assert.Equal(t, 2, s.Requests(http.MethodPut, path))
+
+	// Server errors are retried by the client
+	s.InjectFailure(Failure{Method: http.MethodGet, Path: path, Status: http.StatusServiceUnavailable, Times: 2})
+	got, err := c.GetActivity(ctx, activity.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", got.Name)
+
+	// A 429 comes back as a rate-limit error with the usage exhausted
+	s.InjectFailure(Failure{Status: http.StatusTooManyRequests})
+	_, err = c.GetActivity(ctx, activity.ID)
+	require.ErrorIs(t, err, strava.ErrRateLimited)
+}
+
+func TestServer_PushSubscriptions(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	var received []Event
+	app := http.NewServeMux()
+	app.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			assert.Equal(t, "verify", r.URL.Query().Get("hub.verify_token"))
+			writeJSON(w, http.StatusOK, map[string]string{"hub.challenge": r.URL.Query().Get("hub.challenge")})
+			return
+		}
+		var event Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received = append(received, event)
+	})
+	appServer := httptest.NewServer(app)
+	defer appServer.Close()
+
+	c := strava.NewClient("", "", ClientID, ClientSecret, strava.WithAPIURL(s.APIURL()))
+	ctx := context.Background()
+
+	created, err := c.CreateWebhookSubscription(ctx, appServer.URL+"/webhook", "verify")
+	require.NoError(t, err)
+
+	_, err = c.CreateWebhookSubscription(ctx, appServer.URL+"/webhook", "verify")
+	var apiErr *strava.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.True(t, apiErr.HasCode("already exists"))
+
+	require.NoError(t, s.Notify(ctx, ActivityCreated(1, 10)))
+	require.Len(t, received, 1)
+	assert.Equal(t, created.ID, received[0].SubscriptionID)
+	assert.Equal(t, int64(10), received[0].ObjectID)
+
+	require.NoError(t, c.DeleteWebhookSubscription(ctx, created.ID))
+	assert.Empty(t, s.Subscriptions())
+	assert.Error(t, s.Notify(ctx, ActivityCreated(1, 11)))
+}
+
+func activityIDs(activities []strava.Activity) []int64 {
+	ids := make([]int64, len(activities))
+	for i, a := range activities {
+		ids[i] = a.ID
+	}
+	return ids
+}
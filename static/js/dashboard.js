@@ -56,6 +56,9 @@ const normalizeActivityType = (type, name = '') => {
     return type; // Return original type as fallback
 };
 
+// CSRF token rendered by the server, sent with every POST request
+const csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+
 // Format duration in seconds to hours and minutes
 function formatDuration(seconds) {
     const hours = Math.floor(seconds / 3600);
@@ -87,18 +90,18 @@ function formatDate(dateStr) {
     });
 }
 
-// Load activities from Strava
+// Load activities through the server, which holds the Strava token
 async function loadActivities() {
-    console.log('Loading activities with token:', window.accessToken);
     try {
-        const response = await fetch('https://www.strava.com/api/v3/athlete/activities', {
-            headers: {
-                'Authorization': `Bearer ${window.accessToken}`
-            }
-        });
+        const response = await fetch('/api/activities?page=1&per_page=30');
+
+        if (response.status === 401) {
+            window.location.href = '/';
+            return;
+        }
 
         if (!response.ok) {
-            console.error('Strava API error:', response.status, response.statusText);
+            console.error('Activities API error:', response.status, response.statusText);
             throw new Error('Failed to fetch activities');
         }
 
@@ -175,23 +178,30 @@ function displayRecentActivities(activities) {
     container.innerHTML = '';
     
     activities.forEach(activity => {
-        const div = document.createElement('div');
-        div.className = 'activity';
-        const isStationary = stationaryActivities.includes(activity.type);
-        
-        div.innerHTML = `
-            <h3>${activity.name}</h3>
-            <p>Tipo: ${activity.type}</p>
-            ${isStationary 
-                ? `<p>Tempo: ${formatDuration(activity.moving_time)}</p>`
-                : `<p>Distância: ${formatDistance(activity.distance)}</p>`
-            }
-            <p>Data: ${formatDate(activity.start_date_local)}</p>
-        `;
-        container.appendChild(div);
+        container.appendChild(activityElement(activity));
     });
 }
 
+// Build an activity card. Names are typed by athletes, so they are set as
+// text and never parsed as HTML.
+function activityElement(activity) {
+    const div = document.createElement('div');
+    div.className = 'activity';
+    div.innerHTML = `
+        <h3 class="activity-name"></h3>
+        <p class="activity-type"></p>
+        <p class="activity-metric"></p>
+        <p class="activity-date"></p>
+    `;
+    div.querySelector('.activity-name').textContent = activity.name;
+    div.querySelector('.activity-type').textContent = `Tipo: ${activity.type}`;
+    div.querySelector('.activity-metric').textContent = stationaryActivities.includes(activity.type)
+        ? `Tempo: ${formatDuration(activity.moving_time)}`
+        : `Distância: ${formatDistance(activity.distance)}`;
+    div.querySelector('.activity-date').textContent = `Data: ${formatDate(activity.start_date_local)}`;
+    return div;
+}
+
 // Update toggleMoreActivities to show appropriate metrics
 function toggleMoreActivities() {
     const expandedContainer = document.getElementById('activities-expanded');
@@ -206,46 +216,167 @@ function toggleMoreActivities() {
         
         expandedContainer.innerHTML = '';
         window.remainingActivities.forEach(activity => {
-            const div = document.createElement('div');
-            div.className = 'activity';
-            const isStationary = stationaryActivities.includes(activity.type);
-            
-            div.innerHTML = `
-                <h3>${activity.name}</h3>
-                <p>Tipo: ${activity.type}</p>
-                ${isStationary 
-                    ? `<p>Tempo: ${formatDuration(activity.moving_time)}</p>`
-                    : `<p>Distância: ${formatDistance(activity.distance)}</p>`
-                }
-                <p>Data: ${formatDate(activity.start_date_local)}</p>
-            `;
-            expandedContainer.appendChild(div);
+            expandedContainer.appendChild(activityElement(activity));
         });
     }
 }
 
+// Show the proposed names so the athlete can accept, reroll or skip each one
+function displayRenamePreview(items) {
+    const container = document.getElementById('rename-preview-items');
+    container.innerHTML = '';
+
+    if (items.length === 0) {
+        container.innerHTML = '<p>Nenhuma atividade com nome padrão para renomear.</p>';
+    }
+
+    items.forEach(item => {
+        const div = document.createElement('div');
+        div.className = 'activity';
+        div.dataset.activityId = item.activity_id;
+        div.innerHTML = `
+            <label><input type="checkbox" class="rename-accept" checked> Aceitar</label>
+            <h3 class="rename-new-name"></h3>
+            <p class="rename-old-name"></p>
+            <button class="show-more-btn rename-reroll">🎲 Outro nome</button>
+        `;
+        div.querySelector('.rename-new-name').textContent = item.new_name;
+        div.querySelector('.rename-old-name').textContent = `Antes: ${item.old_name}`;
+        div.querySelector('.rename-reroll').addEventListener('click', () => rerollName(div));
+        container.appendChild(div);
+    });
+
+    document.getElementById('rename-preview').style.display = 'block';
+}
+
+const failureReasons = {
+    rate_limited: 'limite de requisições do Strava atingido',
+    not_found: 'atividade não encontrada',
+    unauthorized: 'sem permissão no Strava',
+    strava_error: 'erro no Strava',
+    timeout: 'tempo esgotado',
+    error: 'erro inesperado'
+};
+
+// Tell the athlete what a rename actually did
+function displayRenameReport(result) {
+    const container = document.getElementById('rename-report');
+    container.innerHTML = '';
+    container.className = result.failed > 0 ? 'status inactive' : 'status active';
+
+    const summary = document.createElement('p');
+    summary.textContent = `${result.renamed} renomeada(s), ${result.skipped} ignorada(s), ${result.failed} com falha.`;
+    container.appendChild(summary);
+
+    result.results.failed.forEach(item => {
+        const p = document.createElement('p');
+        p.textContent = `${item.old_name}: ${failureReasons[item.reason] || item.reason}`;
+        container.appendChild(p);
+    });
+
+    result.results.skipped.filter(item => item.reason === 'name_changed').forEach(item => {
+        const p = document.createElement('p');
+        p.textContent = `${item.old_name}: renomeada no Strava depois da prévia, mantida`;
+        container.appendChild(p);
+    });
+
+    result.results.skipped.filter(item => item.reason === 'undone').forEach(item => {
+        const p = document.createElement('p');
+        p.textContent = `${item.old_name}: nome restaurado por você, mantido`;
+        container.appendChild(p);
+    });
+
+    container.style.display = 'block';
+}
+
+function hideRenamePreview() {
+    document.getElementById('rename-preview').style.display = 'none';
+    document.getElementById('rename-preview-items').innerHTML = '';
+}
+
+async function rerollName(div) {
+    try {
+        const response = await fetch('/api/rename/reroll', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken
+            },
+            body: JSON.stringify({ activity_ids: [Number(div.dataset.activityId)] })
+        });
+
+        if (!response.ok) {
+            throw new Error('Failed to reroll name');
+        }
+
+        const result = await response.json();
+        if (result.items.length > 0) {
+            div.querySelector('.rename-new-name').textContent = result.items[0].new_name;
+        }
+    } catch (error) {
+        console.error('Error rerolling name:', error);
+        alert('Erro ao sortear outro nome. Por favor, gere a prévia novamente.');
+    }
+}
+
 // Add event listeners for buttons
 document.getElementById('rename').addEventListener('click', async function() {
     const button = this;
     button.disabled = true;
-    button.innerHTML = '<span>Renomeando...</span>';
+    button.innerHTML = '<span>Gerando prévia...</span>';
     
     try {
-        const response = await fetch('/rename-activities', {
+        const response = await fetch('/api/rename/preview', {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json'
+                'X-CSRF-Token': csrfToken
             }
         });
 
         if (!response.ok) {
-            const errorData = await response.json().catch(() => ({}));
-            throw new Error(errorData.message || 'Failed to rename activities');
+            throw new Error('Failed to preview renames');
+        }
+
+        const plan = await response.json();
+        displayRenamePreview(plan.items);
+    } catch (error) {
+        console.error('Error previewing renames:', error);
+        alert('Erro ao gerar a prévia. Por favor, tente novamente.');
+    } finally {
+        button.disabled = false;
+        button.innerHTML = '<span>Renomear Todas</span>';
+    }
+});
+
+document.getElementById('rename-apply').addEventListener('click', async function() {
+    const button = this;
+    const accepted = Array.from(document.querySelectorAll('#rename-preview-items .activity'))
+        .filter(div => div.querySelector('.rename-accept').checked)
+        .map(div => Number(div.dataset.activityId));
+
+    button.disabled = true;
+    button.innerHTML = '<span>Renomeando...</span>';
+
+    try {
+        const response = await fetch('/api/rename/apply', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken
+            },
+            body: JSON.stringify({ activity_ids: accepted })
+        });
+
+        // A stopped rename still reports what was done
+        if (!response.ok && !response.headers.get('Content-Type')?.includes('application/json')) {
+            throw new Error('Failed to apply renames');
         }
 
         const result = await response.json();
-        console.log(`Successfully renamed ${result.renamed} activities`);
-        
+        console.log(`Renamed ${result.renamed} activities, ${result.failed} failed`);
+
+        hideRenamePreview();
+        displayRenameReport(result);
         // Reload activities to show new names
         await loadActivities();
     } catch (error) {
@@ -253,7 +384,40 @@ document.getElementById('rename').addEventListener('click', async function() {
         alert('Erro ao renomear atividades. Por favor, tente novamente.');
     } finally {
         button.disabled = false;
-        button.innerHTML = '<span>Renomear Todas</span>';
+        button.innerHTML = '<span>Aplicar Selecionados</span>';
+    }
+});
+
+document.getElementById('rename-cancel').addEventListener('click', hideRenamePreview);
+
+document.getElementById('backfill').addEventListener('click', async function() {
+    const button = this;
+    button.disabled = true;
+    button.innerHTML = '<span>Iniciando...</span>';
+
+    try {
+        const response = await fetch('/api/backfill', {
+            method: 'POST',
+            headers: {
+                'X-CSRF-Token': csrfToken
+            }
+        });
+
+        if (response.status === 409) {
+            alert('O histórico já está sendo renomeado.');
+            return;
+        }
+        if (!response.ok) {
+            throw new Error('Failed to start backfill');
+        }
+
+        alert('Renomeando o histórico do último ano. Isso pode levar alguns minutos.');
+    } catch (error) {
+        console.error('Error starting backfill:', error);
+        alert('Erro ao renomear o histórico. Por favor, tente novamente.');
+    } finally {
+        button.disabled = false;
+        button.innerHTML = '<span>Renomear Histórico</span>';
     }
 });
 
@@ -265,7 +429,10 @@ document.getElementById('subscribe').addEventListener('click', async function()
     try {
         console.log('Sending subscribe request...');
         const response = await fetch('/subscribe', {
-            method: 'POST'
+            method: 'POST',
+            headers: {
+                'X-CSRF-Token': csrfToken
+            }
         });
 
         if (!response.ok) {
@@ -322,7 +489,10 @@ document.getElementById('unsubscribe').addEventListener('click', async function(
     try {
         console.log('Sending unsubscribe request...');
         const response = await fetch('/unsubscribe', {
-            method: 'POST'
+            method: 'POST',
+            headers: {
+                'X-CSRF-Token': csrfToken
+            }
         });
 
         if (!response.ok) {
@@ -343,6 +513,49 @@ document.getElementById('unsubscribe').addEventListener('click', async function(
     }
 });
 
+document.getElementById('logout').addEventListener('click', async function() {
+    try {
+        await fetch('/logout', {
+            method: 'POST',
+            headers: {
+                'X-CSRF-Token': csrfToken
+            }
+        });
+    } finally {
+        window.location.href = '/';
+    }
+});
+
+document.getElementById('disconnect').addEventListener('click', async function() {
+    if (!confirm('Isso remove o acesso do zoAtleta ao seu Strava e apaga todos os seus dados. Continuar?')) {
+        return;
+    }
+
+    const button = this;
+    button.disabled = true;
+    button.innerHTML = '<span>Desconectando...</span>';
+
+    try {
+        const response = await fetch('/disconnect', {
+            method: 'POST',
+            headers: {
+                'X-CSRF-Token': csrfToken
+            }
+        });
+
+        if (!response.ok) {
+            throw new Error('Failed to disconnect');
+        }
+
+        window.location.href = '/';
+    } catch (error) {
+        console.error('Error:', error);
+        alert('Erro ao desconectar. Por favor, tente novamente.');
+        button.disabled = false;
+        button.innerHTML = '<span>Desconectar do Strava</span>';
+    }
+});
+
 // Check status and load activities when page loads
 checkSubscriptionStatus();
 loadActivities();
\ No newline at end of file
@@ -0,0 +1,137 @@
+const csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+
+const sourceLabels = {
+    manual: 'Manual',
+    webhook: 'Automática',
+    backfill: 'Histórico'
+};
+
+function formatDate(dateStr) {
+    return new Date(dateStr).toLocaleDateString('pt-BR', {
+        year: 'numeric',
+        month: 'long',
+        day: 'numeric',
+        hour: '2-digit',
+        minute: '2-digit'
+    });
+}
+
+function dateQuery() {
+    const params = new URLSearchParams();
+    const from = document.getElementById('history-from').value;
+    const to = document.getElementById('history-to').value;
+    if (from) params.set('from', from);
+    if (to) params.set('to', to);
+    return params;
+}
+
+// Load the renames in the selected period
+async function loadHistory() {
+    try {
+        const response = await fetch(`/api/renames?${dateQuery()}`);
+
+        if (response.status === 401) {
+            window.location.href = '/';
+            return;
+        }
+
+        if (!response.ok) {
+            throw new Error('Failed to fetch history');
+        }
+
+        displayHistory(await response.json());
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+function displayHistory(records) {
+    const container = document.getElementById('history-items');
+    container.innerHTML = '';
+
+    if (records.length === 0) {
+        container.innerHTML = '<p>Nenhuma atividade renomeada neste período.</p>';
+        return;
+    }
+
+    records.forEach(record => {
+        const div = document.createElement('div');
+        div.className = 'activity';
+        div.innerHTML = `
+            <h3 class="history-new-name"></h3>
+            <p class="history-original-name"></p>
+            <p>Origem: ${sourceLabels[record.source] || record.source}</p>
+            <p>Data: ${formatDate(record.renamed_at)}</p>
+        `;
+        div.querySelector('.history-new-name').textContent = record.new_name;
+        div.querySelector('.history-original-name').textContent = `Nome original: ${record.original_name}`;
+
+        if (record.undone_at) {
+            const p = document.createElement('p');
+            p.textContent = `Desfeito em ${formatDate(record.undone_at)}`;
+            div.appendChild(p);
+        } else {
+            const button = document.createElement('button');
+            button.className = 'show-more-btn';
+            button.textContent = 'Desfazer';
+            button.addEventListener('click', () => undoRenames({ activity_ids: [record.activity_id] }));
+            div.appendChild(button);
+        }
+        container.appendChild(div);
+    });
+}
+
+async function undoRenames(selection) {
+    try {
+        const response = await fetch('/api/renames/undo', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken
+            },
+            body: JSON.stringify(selection)
+        });
+
+        if (!response.ok && response.status !== 429) {
+            throw new Error('Failed to undo renames');
+        }
+
+        const result = await response.json();
+        if (response.status === 429) {
+            alert(`Limite de requisições do Strava atingido. ${result.renamed} atividade(s) restaurada(s), ${result.failed} pendente(s). Tente novamente mais tarde.`);
+            return;
+        }
+        const changed = result.results.skipped.filter(skip => skip.reason === 'name_changed').length;
+        if (changed > 0) {
+            alert(`${changed} atividade(s) foram renomeadas depois e não foram alteradas.`);
+        }
+    } catch (error) {
+        console.error('Error undoing renames:', error);
+        alert('Erro ao desfazer. Por favor, tente novamente.');
+    } finally {
+        await loadHistory();
+    }
+}
+
+document.getElementById('history-filter').addEventListener('click', loadHistory);
+
+document.getElementById('history-undo-range').addEventListener('click', async function() {
+    const params = dateQuery();
+    if (!params.has('from') && !params.has('to')) {
+        alert('Escolha um período para desfazer.');
+        return;
+    }
+    if (!confirm('Restaurar os nomes originais de todas as atividades renomeadas neste período?')) {
+        return;
+    }
+
+    const button = this;
+    button.disabled = true;
+    try {
+        await undoRenames({ from: params.get('from') || '', to: params.get('to') || '' });
+    } finally {
+        button.disabled = false;
+    }
+});
+
+loadHistory();